@@ -0,0 +1,166 @@
+package contacts
+
+import (
+	"strings"
+)
+
+// AddressLabels are the names used for the regional parts of an address in
+// a particular country.
+type AddressLabels struct {
+	City  string
+	State string
+	Zip   string
+}
+
+// addressFormat describes how a country orders the parts of an address.
+type addressFormat struct {
+	Labels AddressLabels
+	Lines  func(a *Contact) []string
+}
+
+var (
+	defaultAddressLabels = AddressLabels{City: "City", State: "State", Zip: "Zip"}
+
+	// cityStateZip is used by US, Canada and Australia: "City, ST 12345".
+	cityStateZip = func(a *Contact) []string {
+		return append(a.Street, joinNonEmpty(" ", joinNonEmpty(", ", a.City, a.State), a.Zip))
+	}
+	// zipCity is used by most of continental Europe: "12345 City".
+	zipCity = func(a *Contact) []string {
+		return append(a.Street, joinNonEmpty(" ", a.Zip, a.City), a.State)
+	}
+
+	addressFormats = map[string]addressFormat{
+		"US": {defaultAddressLabels, cityStateZip},
+		"CA": {AddressLabels{City: "City", State: "Province", Zip: "Postal Code"}, cityStateZip},
+		"AU": {AddressLabels{City: "Suburb", State: "State", Zip: "Postcode"}, cityStateZip},
+		"GB": {
+			AddressLabels{City: "Town", State: "County", Zip: "Postcode"},
+			func(a *Contact) []string {
+				return append(a.Street, strings.ToUpper(a.City), a.State, strings.ToUpper(a.Zip))
+			},
+		},
+		"IE": {
+			AddressLabels{City: "Town", State: "County", Zip: "Eircode"},
+			func(a *Contact) []string { return append(a.Street, a.City, a.State, a.Zip) },
+		},
+		"DE": {AddressLabels{City: "City", State: "State", Zip: "Postcode"}, zipCity},
+		"AT": {AddressLabels{City: "City", State: "State", Zip: "Postcode"}, zipCity},
+		"CH": {AddressLabels{City: "City", State: "Canton", Zip: "Postcode"}, zipCity},
+		"FR": {AddressLabels{City: "City", State: "Region", Zip: "Postcode"}, zipCity},
+		"NL": {AddressLabels{City: "City", State: "Province", Zip: "Postcode"}, zipCity},
+		"ES": {AddressLabels{City: "City", State: "Province", Zip: "Postcode"}, zipCity},
+		"IT": {
+			AddressLabels{City: "City", State: "Province", Zip: "CAP"},
+			func(a *Contact) []string { return append(a.Street, joinNonEmpty(" ", a.Zip, a.City, a.State)) },
+		},
+		"MX": {
+			AddressLabels{City: "City", State: "State", Zip: "Postal Code"},
+			func(a *Contact) []string {
+				return append(a.Street, joinNonEmpty(" ", a.Zip, joinNonEmpty(", ", a.City, a.State)))
+			},
+		},
+		"JP": {
+			AddressLabels{City: "City", State: "Prefecture", Zip: "Postal Code"},
+			func(a *Contact) []string {
+				zip := ""
+				if a.Zip != "" {
+					zip = "〒" + a.Zip
+				}
+				return append([]string{zip, a.State + a.City}, a.Street...)
+			},
+		},
+	}
+
+	countryNames = map[string]string{
+		"AT": "Austria",
+		"AU": "Australia",
+		"CA": "Canada",
+		"CH": "Switzerland",
+		"DE": "Germany",
+		"ES": "Spain",
+		"FR": "France",
+		"GB": "United Kingdom",
+		"IE": "Ireland",
+		"IT": "Italy",
+		"JP": "Japan",
+		"MX": "Mexico",
+		"NL": "Netherlands",
+		"NZ": "New Zealand",
+		"US": "United States",
+	}
+)
+
+// AddressLines returns the postal address ordered for the contact's country,
+// ending with the country name when a country is set.
+func (c *Contact) AddressLines() []string { return c.MailingAddress("") }
+
+// MailingAddress returns the postal address ordered for the contact's
+// country, or for from, the country the mail is sent from, when it has
+// none. The country line is left off when it is the same as from.
+func (c *Contact) MailingAddress(from string) []string {
+	if !c.HasAddress() {
+		return nil
+	}
+	country := countryCode(c.Country)
+	format, ok := addressFormats[countryCode(c.region(from))]
+	if !ok {
+		format = addressFormats["US"]
+	}
+	var lines []string
+	for _, line := range format.Lines(&Contact{
+		Street: append([]string(nil), c.Street...),
+		City:   strings.TrimSpace(c.City),
+		State:  strings.TrimSpace(c.State),
+		Zip:    strings.TrimSpace(c.Zip),
+	}) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if country != "" && country != countryCode(from) {
+		lines = append(lines, strings.ToUpper(countryName(country)))
+	}
+	return lines
+}
+
+// HasAddress reports whether any part of the postal address is set.
+func (c *Contact) HasAddress() bool {
+	if c == nil {
+		return false
+	}
+	return joinNonEmpty("", strings.Join(c.Street, ""), c.City, c.State, c.Zip) != ""
+}
+
+// AddressLabelsFor returns the field names used for addresses in country.
+func AddressLabelsFor(country string) AddressLabels {
+	if format, ok := addressFormats[countryCode(country)]; ok {
+		return format.Labels
+	}
+	return defaultAddressLabels
+}
+
+func countryCode(country string) string {
+	code := strings.ToUpper(strings.TrimSpace(country))
+	if code == "UK" {
+		return "GB"
+	}
+	return code
+}
+
+func countryName(code string) string {
+	if name, ok := countryNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
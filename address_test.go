@@ -0,0 +1,51 @@
+package contacts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMailingAddress(t *testing.T) {
+	cases := []struct {
+		contact  Contact
+		from     string
+		expected []string
+	}{
+		{
+			Contact{Street: []string{"1 Main St"}, City: "Springfield", State: "IL", Zip: "62701", Country: "US"},
+			"US",
+			[]string{"1 Main St", "Springfield, IL 62701"},
+		},
+		{
+			Contact{Street: []string{"10 Downing Street"}, City: "London", Zip: "sw1a 2aa", Country: "UK"},
+			"US",
+			[]string{"10 Downing Street", "LONDON", "SW1A 2AA", "UNITED KINGDOM"},
+		},
+		{
+			Contact{Street: []string{"Unter den Linden 77"}, City: "Berlin", Zip: "10117", Country: "de"},
+			"DE",
+			[]string{"Unter den Linden 77", "10117 Berlin"},
+		},
+		{
+			Contact{Street: []string{"1-1 Chiyoda"}, City: "Chiyoda-ku", State: "Tokyo", Zip: "100-8111", Country: "JP"},
+			"",
+			[]string{"〒100-8111", "TokyoChiyoda-ku", "1-1 Chiyoda", "JAPAN"},
+		},
+		{
+			Contact{City: "Portland", Zip: "97201"},
+			"US",
+			[]string{"Portland 97201"},
+		},
+		{
+			Contact{Street: []string{"Unter den Linden 77"}, City: "Berlin", Zip: "10117"},
+			"DE",
+			[]string{"Unter den Linden 77", "10117 Berlin"},
+		},
+		{Contact{Country: "US"}, "", nil},
+	}
+	for _, c := range cases {
+		if got := c.contact.MailingAddress(c.from); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("MailingAddress(%q) = %q; expected %q", c.from, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	apiRoute = "api/v1"
+
+	maxAPIBodySize = 1 << 20
+)
+
+// apiRoles is the role needed for each API method.
+var apiRoles = map[string]Role{
+	"GET":    RoleViewer,
+	"POST":   RoleEditor,
+	"PATCH":  RoleEditor,
+	"DELETE": RoleAdmin,
+}
+
+// APIContact is the JSON representation of a Contact used by the API. Its
+// ID is the contact's UUID rather than its DN.
+type APIContact struct {
+	ID            string   `json:"id,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Prefix        string   `json:"prefix,omitempty"`
+	First         string   `json:"first,omitempty"`
+	Middle        string   `json:"middle,omitempty"`
+	Last          string   `json:"last,omitempty"`
+	Suffix        string   `json:"suffix,omitempty"`
+	Nickname      []string `json:"nickname,omitempty"`
+	PhoneticFirst string   `json:"phoneticFirst,omitempty"`
+	PhoneticLast  string   `json:"phoneticLast,omitempty"`
+	Email         []string `json:"email,omitempty"`
+	Phone         []string `json:"phone,omitempty"`
+	Street        []string `json:"street,omitempty"`
+	City          string   `json:"city,omitempty"`
+	State         string   `json:"state,omitempty"`
+	Zip           string   `json:"zip,omitempty"`
+	Country       string   `json:"country,omitempty"`
+	// Birthday is "2006-01-02", or "--01-02" when the year is unknown.
+	Birthday string   `json:"birthday,omitempty"`
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// APILabel is a label and the number of contacts that have it.
+type APILabel struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// APIError is the body of every API error response.
+type APIError struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// NewAPIContact converts c to its API representation.
+func NewAPIContact(c *Contact) APIContact {
+	a := APIContact{
+		ID:            c.UUID(),
+		Name:          c.Name,
+		Prefix:        c.Prefix,
+		First:         c.First,
+		Middle:        c.Middle,
+		Last:          c.Last,
+		Suffix:        c.Suffix,
+		Nickname:      c.Nickname,
+		PhoneticFirst: c.PhoneticFirst,
+		PhoneticLast:  c.PhoneticLast,
+		Email:         c.Email,
+		Phone:         c.Phone,
+		Street:        c.Street,
+		City:          c.City,
+		State:         c.State,
+		Zip:           c.Zip,
+		Country:       c.Country,
+		Labels:        c.Labels,
+	}
+	switch {
+	case c.Birthday.IsZero():
+	case c.Birthday.Year() == 0:
+		a.Birthday = c.Birthday.Format("--01-02")
+	default:
+		a.Birthday = c.Birthday.Format("2006-01-02")
+	}
+	return a
+}
+
+// Contact converts a back to a Contact. The ID of the result is the API ID.
+func (a APIContact) Contact() (*Contact, error) {
+	c := &Contact{
+		ID:            a.ID,
+		Name:          a.Name,
+		Prefix:        a.Prefix,
+		First:         a.First,
+		Middle:        a.Middle,
+		Last:          a.Last,
+		Suffix:        a.Suffix,
+		Nickname:      dedupe(a.Nickname),
+		PhoneticFirst: a.PhoneticFirst,
+		PhoneticLast:  a.PhoneticLast,
+		Email:         dedupe(a.Email),
+		Phone:         dedupe(a.Phone),
+		Street:        dedupe(a.Street),
+		City:          a.City,
+		State:         a.State,
+		Zip:           a.Zip,
+		Country:       a.Country,
+		Labels:        dedupe(a.Labels),
+	}
+	if a.Birthday != "" {
+		if c.Birthday = parseVCardDate(a.Birthday); c.Birthday.IsZero() {
+			return nil, ValidationErrors{"Birthday": fmt.Sprintf("%q is not a date like 2006-01-02 or --01-02", a.Birthday)}
+		}
+	}
+	return c, nil
+}
+
+// handleAPI routes the JSON API:
+//
+//	GET    api/v1/contacts        list, filtered by label, q and sort
+//	POST   api/v1/contacts        create
+//	GET    api/v1/contacts/{id}   get
+//	PATCH  api/v1/contacts/{id}   update the fields present in the body
+//	DELETE api/v1/contacts/{id}   delete
+//	GET    api/v1/labels          labels with counts
+//	GET    api/v1/openapi.json    OpenAPI description of the above
+//
+// Reading needs the viewer role, creating and updating the editor role and
+// deleting the admin role.
+func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, s.apiRoute()), "/")
+	parts := strings.Split(rest, "/")
+	switch {
+	case rest == "openapi.json":
+		s.apiMethods(w, r, map[string]http.HandlerFunc{"GET": s.apiDocument})
+	case rest == "labels":
+		s.apiMethods(w, r, map[string]http.HandlerFunc{"GET": s.apiLabels})
+	case rest == "contacts":
+		s.apiMethods(w, r, map[string]http.HandlerFunc{"GET": s.apiList, "POST": s.apiCreate})
+	case len(parts) == 2 && parts[0] == "contacts":
+		id := parts[1]
+		s.apiMethods(w, r, map[string]http.HandlerFunc{
+			"GET":    func(w http.ResponseWriter, r *http.Request) { s.apiGet(w, r, id) },
+			"PATCH":  func(w http.ResponseWriter, r *http.Request) { s.apiPatch(w, r, id) },
+			"DELETE": func(w http.ResponseWriter, r *http.Request) { s.apiDelete(w, r, id) },
+		})
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.New("no such endpoint"))
+	}
+}
+
+func (s *server) apiMethods(w http.ResponseWriter, r *http.Request, handlers map[string]http.HandlerFunc) {
+	if handler, ok := handlers[r.Method]; ok {
+		if err := allowed(r, apiRoles[r.Method]); err != nil {
+			s.showError(w, r, err)
+			return
+		}
+		handler(w, r)
+		return
+	}
+	var allowed []string
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+}
+
+func (s *server) apiList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	records, err := List(s.config, q["label"])
+	if err != nil {
+		log.Printf("api list: %v", err)
+		writeAPIError(w, errorStatus(err), errors.New("directory unavailable"))
+		return
+	}
+	records = Search(records, q.Get("q"))
+	sort.Sort(sortBy(q.Get("sort"), records))
+	list := make([]APIContact, 0, len(records))
+	for _, contact := range records {
+		list = append(list, NewAPIContact(contact))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) apiGet(w http.ResponseWriter, r *http.Request, id string) {
+	contact, ok := s.apiFind(w, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, NewAPIContact(contact))
+}
+
+func (s *server) apiCreate(w http.ResponseWriter, r *http.Request) {
+	var a APIContact
+	if !readJSON(w, r, &a) {
+		return
+	}
+	contact, err := a.Contact()
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	contact.ID = ""
+	if !s.apiSave(w, nil, contact) {
+		return
+	}
+	created := NewAPIContact(contact)
+	w.Header().Set("Location", path.Join(s.apiRoute(), "contacts", created.ID))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *server) apiPatch(w http.ResponseWriter, r *http.Request, id string) {
+	existing, ok := s.apiFind(w, id)
+	if !ok {
+		return
+	}
+	// Decoding onto the current values only replaces the fields present
+	// in the body.
+	a := NewAPIContact(existing)
+	if !readJSON(w, r, &a) {
+		return
+	}
+	updated, err := a.Contact()
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	updated.ID = existing.ID
+	updated.CommonName = existing.CommonName
+	if !s.apiSave(w, existing, updated) {
+		return
+	}
+	writeJSON(w, http.StatusOK, NewAPIContact(updated))
+}
+
+func (s *server) apiDelete(w http.ResponseWriter, r *http.Request, id string) {
+	contact, ok := s.apiFind(w, id)
+	if !ok {
+		return
+	}
+	if err := Delete(s.config, contact.ID); err != nil {
+		log.Printf("api delete %q: %v", contact.ID, err)
+		writeAPIError(w, errorStatus(err), errors.New(errorMessage(errorStatus(err))))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) apiLabels(w http.ResponseWriter, r *http.Request) {
+	records, err := List(s.config, nil)
+	if err != nil {
+		log.Printf("api labels: %v", err)
+		writeAPIError(w, errorStatus(err), errors.New("directory unavailable"))
+		return
+	}
+	counts := map[string]int{}
+	for _, contact := range records {
+		for _, label := range contact.Labels {
+			counts[label]++
+		}
+	}
+	labels := make([]APILabel, 0, len(counts))
+	for label, count := range counts {
+		labels = append(labels, APILabel{Label: label, Count: count})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Label < labels[j].Label })
+	writeJSON(w, http.StatusOK, labels)
+}
+
+// apiFind looks up the contact with the API id, writing an error response
+// if it cannot be found.
+func (s *server) apiFind(w http.ResponseWriter, id string) (*Contact, bool) {
+	contact, err := s.contactByUUID(id)
+	switch {
+	case err == ErrNotFound:
+		writeAPIError(w, http.StatusNotFound, err)
+		return nil, false
+	case err != nil:
+		log.Printf("api find %q: %v", id, err)
+		writeAPIError(w, errorStatus(err), errors.New("directory unavailable"))
+		return nil, false
+	}
+	return contact, true
+}
+
+// apiSave saves updated, writing an error response if it fails.
+func (s *server) apiSave(w http.ResponseWriter, original, updated *Contact) bool {
+	err := Save(s.config, original, updated)
+	var errs ValidationErrors
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &errs):
+		writeAPIError(w, http.StatusUnprocessableEntity, errs)
+	default:
+		log.Printf("api save %q: %v", updated.ID, err)
+		writeAPIError(w, errorStatus(err), errors.New(errorMessage(errorStatus(err))))
+	}
+	return false
+}
+
+func (s *server) apiRoute() string { return path.Join(s.baseRoute, apiRoute) }
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writing json: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	body := APIError{Error: err.Error()}
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		body.Fields = errs
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,297 @@
+package contacts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// testDirectory is a writable in-memory LDAP directory, just enough of one
+// for the contacts to be listed, created, modified and deleted.
+type testDirectory struct {
+	mu      sync.Mutex
+	entries map[string]gatewayEntry
+}
+
+// serveTestDirectory starts a testDirectory holding entries, keyed by DN,
+// and returns the Config to reach it.
+func serveTestDirectory(t *testing.T, entries map[string]map[string][]string) Config {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	d := &testDirectory{entries: map[string]gatewayEntry{}}
+	for dn, attrs := range entries {
+		d.entries[normalizeDN(dn)] = newGatewayEntry(dn, attrs)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serveConn(conn)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return Config{Host: host, Port: port, BaseDN: "dc=example", Username: "cn=admin,dc=example", Password: "secret"}
+}
+
+func (d *testDirectory) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		packet, err := readRequest(r)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		d.mu.Lock()
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = append(responses, ldapResult(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, ""))
+		case ldap.ApplicationUnbindRequest:
+			d.mu.Unlock()
+			return
+		case ldap.ApplicationSearchRequest:
+			responses = d.search(id, op)
+		case ldap.ApplicationAddRequest:
+			responses = append(responses, ldapResult(id, ldap.ApplicationAddResponse, d.add(op), ""))
+		case ldap.ApplicationModifyRequest:
+			responses = append(responses, ldapResult(id, ldap.ApplicationModifyResponse, d.modify(op), ""))
+		case ldap.ApplicationDelRequest:
+			code := ldap.LDAPResultNoSuchObject
+			if dn := normalizeDN(packetString(op)); d.entries[dn].dn != "" {
+				delete(d.entries, dn)
+				code = ldap.LDAPResultSuccess
+			}
+			responses = append(responses, ldapResult(id, ldap.ApplicationDelResponse, code, ""))
+		default:
+			responses = append(responses, ldapResult(id, op.Tag+1, ldap.LDAPResultUnwillingToPerform, ""))
+		}
+		d.mu.Unlock()
+		for _, response := range responses {
+			if _, err := conn.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (d *testDirectory) search(id int64, op *ber.Packet) []*ber.Packet {
+	base := normalizeDN(packetString(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	var wanted []string
+	for _, attr := range op.Children[7].Children {
+		wanted = append(wanted, packetString(attr))
+	}
+	if scope == ldap.ScopeBaseObject && d.entries[base].dn == "" {
+		return []*ber.Packet{ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject, "")}
+	}
+	var responses []*ber.Packet
+	for dn, entry := range d.entries {
+		if (dn == base || strings.HasSuffix(dn, ","+base)) && entry.matches(op.Children[6]) {
+			responses = append(responses, entry.packet(id, wanted, false))
+		}
+	}
+	return append(responses, ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func (d *testDirectory) add(op *ber.Packet) int {
+	dn := packetString(op.Children[0])
+	if d.entries[normalizeDN(dn)].dn != "" {
+		return ldap.LDAPResultEntryAlreadyExists
+	}
+	attrs := map[string][]string{}
+	for _, attr := range op.Children[1].Children {
+		attrs[packetString(attr.Children[0])] = packetValues(attr.Children[1])
+	}
+	d.entries[normalizeDN(dn)] = newGatewayEntry(dn, attrs)
+	return ldap.LDAPResultSuccess
+}
+
+func (d *testDirectory) modify(op *ber.Packet) int {
+	entry := d.entries[normalizeDN(packetString(op.Children[0]))]
+	if entry.dn == "" {
+		return ldap.LDAPResultNoSuchObject
+	}
+	for _, change := range op.Children[1].Children {
+		kind, _ := change.Children[0].Value.(int64)
+		name := packetString(change.Children[1].Children[0])
+		key, values := strings.ToLower(name), packetValues(change.Children[1].Children[1])
+		switch kind {
+		case ldap.AddAttribute:
+			entry.attrs[key] = append(entry.attrs[key], values...)
+		case ldap.DeleteAttribute:
+			if len(values) == 0 {
+				delete(entry.attrs, key)
+				break
+			}
+			var kept []string
+			for _, v := range entry.attrs[key] {
+				if !containsString(values, v) {
+					kept = append(kept, v)
+				}
+			}
+			entry.attrs[key] = kept
+		case ldap.ReplaceAttribute:
+			entry.attrs[key] = values
+		}
+		entry.names[key] = name
+		if len(entry.attrs[key]) == 0 {
+			delete(entry.attrs, key)
+		}
+	}
+	return ldap.LDAPResultSuccess
+}
+
+func packetValues(set *ber.Packet) []string {
+	var values []string
+	for _, v := range set.Children {
+		values = append(values, packetString(v))
+	}
+	return values
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func testAPIServer(t *testing.T) *server {
+	t.Helper()
+	config := serveTestDirectory(t, map[string]map[string][]string{
+		"cn=Jane Doe,ou=contacts,dc=example": {
+			"objectClass": {"contact", "inetOrgPerson"},
+			"cn":          {"Jane Doe"},
+			"displayName": {"Jane Doe"},
+			"mail":        {"jane@example.com"},
+			"l":           {"Springfield"},
+			"label":       {"family"},
+		},
+	})
+	return &server{baseRoute: "/contacts/", config: config, dav: &davState{}, contacts: &contactCache{}}
+}
+
+// apiRequest calls the API as a user with role, decoding the response body
+// into v when it is not nil.
+func apiRequest(t *testing.T, s *server, role Role, method, target, body string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), userKey{}, &User{Name: "tester", Role: role}))
+	w := httptest.NewRecorder()
+	s.handleAPI(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v\n%s", method, target, err, w.Body)
+		}
+	}
+	return w
+}
+
+func TestAPIContacts(t *testing.T) {
+	s := testAPIServer(t)
+	jane := (&Contact{ID: "cn=Jane Doe,ou=contacts,dc=example"}).UUID()
+
+	var list []APIContact
+	if w := apiRequest(t, s, RoleViewer, "GET", "/contacts/api/v1/contacts?label=family", "", &list); w.Code != http.StatusOK ||
+		len(list) != 1 || list[0].ID != jane {
+		t.Fatalf("list: %d %+v", w.Code, list)
+	}
+
+	var created APIContact
+	w := apiRequest(t, s, RoleEditor, "POST", "/contacts/api/v1/contacts", `{"first":"John","last":"Roe","email":["john@example.org"]}`, &created)
+	john := (&Contact{ID: "cn=John Roe,ou=contacts,dc=example"}).UUID()
+	if w.Code != http.StatusCreated || created.ID != john || created.First != "John" {
+		t.Errorf("create: %d %+v", w.Code, created)
+	}
+	if got := w.Header().Get("Location"); got != "/contacts/api/v1/contacts/"+john {
+		t.Errorf("create: Location %q", got)
+	}
+
+	var got APIContact
+	if w := apiRequest(t, s, RoleViewer, "GET", "/contacts/api/v1/contacts/"+john, "", &got); w.Code != http.StatusOK || got.Last != "Roe" {
+		t.Errorf("get created: %d %+v", w.Code, got)
+	}
+
+	var patched APIContact
+	w = apiRequest(t, s, RoleEditor, "PATCH", "/contacts/api/v1/contacts/"+jane, `{"city":"Shelbyville"}`, &patched)
+	if w.Code != http.StatusOK || patched.City != "Shelbyville" || patched.Name != "Jane Doe" ||
+		len(patched.Email) != 1 || len(patched.Labels) != 1 {
+		t.Errorf("patch: %d %+v", w.Code, patched)
+	}
+	got = APIContact{}
+	apiRequest(t, s, RoleViewer, "GET", "/contacts/api/v1/contacts/"+jane, "", &got)
+	if got.City != "Shelbyville" || got.Email[0] != "jane@example.com" || got.Labels[0] != "family" {
+		t.Errorf("patch left %+v", got)
+	}
+
+	if w := apiRequest(t, s, RoleAdmin, "DELETE", "/contacts/api/v1/contacts/"+john, "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("delete: %d %s", w.Code, w.Body)
+	}
+	var apiErr APIError
+	if w := apiRequest(t, s, RoleViewer, "GET", "/contacts/api/v1/contacts/"+john, "", &apiErr); w.Code != http.StatusNotFound || apiErr.Error == "" {
+		t.Errorf("get deleted: %d %+v", w.Code, apiErr)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	s := testAPIServer(t)
+	jane := "/contacts/api/v1/contacts/" + (&Contact{ID: "cn=Jane Doe,ou=contacts,dc=example"}).UUID()
+
+	for _, test := range []struct {
+		role         Role
+		method, path string
+		body         string
+		code         int
+		allow        string
+		field        string
+	}{
+		{RoleViewer, "GET", "/contacts/api/v1/nothing", "", http.StatusNotFound, "", ""},
+		{RoleViewer, "GET", "/contacts/api/v1/contacts/unknown", "", http.StatusNotFound, "", ""},
+		{RoleAdmin, "PUT", jane, "{}", http.StatusMethodNotAllowed, "DELETE, GET, PATCH", ""},
+		{RoleAdmin, "DELETE", "/contacts/api/v1/contacts", "", http.StatusMethodNotAllowed, "GET, POST", ""},
+		{RoleEditor, "POST", "/contacts/api/v1/contacts", `{"name":"Mary","birthday":"soon"}`, http.StatusUnprocessableEntity, "", "Birthday"},
+		{RoleEditor, "PATCH", jane, `{"email":["not an address"]}`, http.StatusUnprocessableEntity, "", "Email"},
+		{RoleEditor, "POST", "/contacts/api/v1/contacts", `{"name":`, http.StatusBadRequest, "", ""},
+		{RoleViewer, "POST", "/contacts/api/v1/contacts", `{"name":"Mary"}`, http.StatusForbidden, "", ""},
+		{RoleViewer, "PATCH", jane, `{"city":"Ogdenville"}`, http.StatusForbidden, "", ""},
+		{RoleEditor, "DELETE", jane, "", http.StatusForbidden, "", ""},
+		{RoleNone, "GET", jane, "", http.StatusForbidden, "", ""},
+	} {
+		var apiErr APIError
+		w := apiRequest(t, s, test.role, test.method, test.path, test.body, &apiErr)
+		if w.Code != test.code || apiErr.Error == "" {
+			t.Errorf("%s %s as %s: %d %+v, want %d", test.method, test.path, test.role, w.Code, apiErr, test.code)
+		}
+		if got := w.Header().Get("Allow"); got != test.allow {
+			t.Errorf("%s %s: Allow %q, want %q", test.method, test.path, got, test.allow)
+		}
+		if test.field != "" && apiErr.Fields[test.field] == "" {
+			t.Errorf("%s %s: no %s error in %+v", test.method, test.path, test.field, apiErr)
+		}
+	}
+
+	var got APIContact
+	apiRequest(t, s, RoleViewer, "GET", jane, "", &got)
+	if got.City != "Springfield" || len(got.Email) != 1 {
+		t.Errorf("rejected requests changed the contact: %+v", got)
+	}
+}
@@ -0,0 +1,278 @@
+package contacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Role is what a signed in user may do. Each role may do everything the
+// roles before it may.
+type Role int
+
+const (
+	// RoleNone may not see any contacts.
+	RoleNone Role = iota
+	// RoleViewer may browse and export contacts.
+	RoleViewer
+	// RoleEditor may also create, edit and import contacts.
+	RoleEditor
+	// RoleAdmin may also delete contacts and see webhook deliveries.
+	RoleAdmin
+)
+
+const authCacheTTL = time.Minute
+
+var roleNames = []string{"none", "viewer", "editor", "admin"}
+
+func (r Role) String() string {
+	if r < RoleNone || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole returns the role called name.
+func ParseRole(name string) (Role, error) {
+	for i, n := range roleNames {
+		if strings.EqualFold(strings.TrimSpace(name), n) {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q, expected one of %s", name, strings.Join(roleNames, ", "))
+}
+
+// AuthConfig configures signing in to the web server. Users are found in
+// the directory and authenticated by binding as them; their role is the
+// highest of DefaultRole, the role given to their name in Users and those of
+// the Groups they are a member of.
+type AuthConfig struct {
+	// UserFilter finds the entry of the user signing in, with %s replaced
+	// by the escaped user name, for example "(uid=%s)". Signing in is not
+	// required when it is empty.
+	UserFilter string
+	// UserBaseDN is searched for users, defaulting to the BaseDN.
+	UserBaseDN string
+
+	// Groups maps the DNs of directory groups to the role of their members.
+	// Members are listed by DN in member or uniqueMember, or by name in
+	// memberUid.
+	Groups map[string]Role
+	// Users maps user names to roles.
+	Users map[string]Role
+	// DefaultRole is given to every user who signs in.
+	DefaultRole Role
+}
+
+// Enabled reports whether users must sign in.
+func (a AuthConfig) Enabled() bool { return a.UserFilter != "" }
+
+// User is someone signed in to the web server.
+type User struct {
+	Name string
+	DN   string
+	Role Role
+}
+
+func (u *User) CanView() bool   { return u != nil && u.Role >= RoleViewer }
+func (u *User) CanEdit() bool   { return u != nil && u.Role >= RoleEditor }
+func (u *User) CanDelete() bool { return u != nil && u.Role >= RoleAdmin }
+func (u *User) IsAdmin() bool   { return u != nil && u.Role >= RoleAdmin }
+
+// ErrInvalidCredentials is returned when a user name or password is wrong.
+var ErrInvalidCredentials = errors.New("invalid user name or password")
+
+// Authenticate checks the password of the user called name against the
+// directory and works out their role.
+func Authenticate(config Config, name, password string) (*User, error) {
+	auth := config.Auth
+	if name == "" || password == "" {
+		// An empty password would be an unauthenticated bind, which
+		// succeeds for any DN.
+		return nil, ErrInvalidCredentials
+	}
+	base := auth.UserBaseDN
+	if base == "" {
+		base = config.BaseDN
+	}
+	request := ldap.NewSearchRequest(
+		base,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, 0, false,
+		fmt.Sprintf(auth.UserFilter, ldap.EscapeFilter(name)),
+		[]string{"dn"}, nil)
+	var dns []string
+	if err := getEntries(config, request, func(e *ldap.Entry) { dns = append(dns, e.DN) }); err != nil &&
+		!hasResultCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	if len(dns) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := connect(Config{Host: config.Host, Port: config.Port, Username: dns[0], Password: password})
+	if hasResultCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	user := &User{Name: name, DN: dns[0], Role: auth.DefaultRole}
+	for userName, role := range auth.Users {
+		if strings.EqualFold(userName, name) && role > user.Role {
+			user.Role = role
+		}
+	}
+	for group, role := range auth.Groups {
+		if role <= user.Role {
+			continue
+		}
+		member, err := isMember(config, group, user)
+		if err != nil {
+			return nil, err
+		}
+		if member {
+			user.Role = role
+		}
+	}
+	return user, nil
+}
+
+// isMember reports whether user is a member of the group with the DN group.
+func isMember(config Config, group string, user *User) (bool, error) {
+	request := ldap.NewSearchRequest(
+		group,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		fmt.Sprintf("(|(member=%[1]s)(uniqueMember=%[1]s)(memberUid=%[2]s))",
+			ldap.EscapeFilter(user.DN), ldap.EscapeFilter(user.Name)),
+		[]string{"dn"}, nil)
+	found := false
+	err := getEntries(config, request, func(*ldap.Entry) { found = true })
+	if hasResultCode(err, ldap.LDAPResultNoSuchObject) {
+		log.Printf("role group %q does not exist", group)
+		return false, nil
+	}
+	return found, err
+}
+
+type userKey struct{}
+
+// userFrom returns the user making the request, or nil when nobody has
+// signed in.
+func userFrom(r *http.Request) *User {
+	if r == nil {
+		return nil
+	}
+	user, _ := r.Context().Value(userKey{}).(*User)
+	return user
+}
+
+// authCache remembers recent sign ins so that every request does not
+// need to bind to the directory.
+type authCache struct {
+	sync.Mutex
+	users map[[sha256.Size]byte]cachedUser
+}
+
+type cachedUser struct {
+	user    *User
+	expires time.Time
+}
+
+func (s *server) signIn(name, password string) (*User, error) {
+	key := sha256.Sum256([]byte(name + "\x00" + password))
+	now := time.Now()
+	s.users.Lock()
+	cached, ok := s.users.users[key]
+	s.users.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.user, nil
+	}
+
+	user, err := Authenticate(s.config, name, password)
+	if err != nil {
+		return nil, err
+	}
+	s.users.Lock()
+	defer s.users.Unlock()
+	if s.users.users == nil {
+		s.users.users = map[[sha256.Size]byte]cachedUser{}
+	}
+	for k, v := range s.users.users {
+		if now.After(v.expires) {
+			delete(s.users.users, k)
+		}
+	}
+	s.users.users[key] = cachedUser{user: user, expires: now.Add(authCacheTTL)}
+	return user, nil
+}
+
+// authenticate requires requests to carry the credentials of a directory
+// user, using HTTP basic authentication so that the API and CardDAV
+// clients can sign in the same way as browsers. Everybody is an admin when
+// signing in is not required.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := &User{Role: RoleAdmin}
+		if s.config.Auth.Enabled() {
+			name, password, ok := r.BasicAuth()
+			if !ok {
+				s.challenge(w, r, errors.New("not signed in"))
+				return
+			}
+			var err error
+			if user, err = s.signIn(name, password); err != nil {
+				if errors.Is(err, ErrInvalidCredentials) {
+					s.challenge(w, r, fmt.Errorf("signing in %q: %w", name, err))
+				} else {
+					s.showError(w, r, fmt.Errorf("signing in %q: %w", name, err))
+				}
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+func (s *server) challenge(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Contacts", charset="UTF-8"`)
+	s.showError(w, r, &statusError{http.StatusUnauthorized, err})
+}
+
+// require only lets users with at least role through to next.
+func (s *server) require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := allowed(r, role); err != nil {
+			s.showError(w, r, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowed returns an error reported as 403 Forbidden unless the user making
+// the request has at least role.
+func allowed(r *http.Request, role Role) error {
+	user := userFrom(r)
+	if user != nil && user.Role >= role {
+		return nil
+	}
+	name := "anonymous"
+	if user != nil && user.Name != "" {
+		name = user.Name
+	}
+	return &statusError{http.StatusForbidden, fmt.Errorf("%s needs the %s role", name, role)}
+}
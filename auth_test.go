@@ -0,0 +1,93 @@
+package contacts
+
+import (
+	"crypto/sha256"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, name := range []string{"none", "viewer", "Editor", " admin "} {
+		role, err := ParseRole(name)
+		if err != nil || !strings.EqualFold(role.String(), strings.TrimSpace(name)) {
+			t.Errorf("ParseRole(%q) = %v, %v", name, role, err)
+		}
+	}
+	if _, err := ParseRole("owner"); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	s := &server{
+		baseRoute: "/contacts/",
+		config:    Config{Host: "127.0.0.1", Port: "1", Auth: AuthConfig{UserFilter: "(uid=%s)"}},
+		tmpl:      template.New("").Funcs(templateFuncs),
+	}
+	if err := s.init(Templates); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	s.users.users = map[[sha256.Size]byte]cachedUser{
+		sha256.Sum256([]byte("vera\x00secret")):  {&User{Name: "vera", Role: RoleViewer}, expires},
+		sha256.Sum256([]byte("eddie\x00secret")): {&User{Name: "eddie", Role: RoleEditor}, expires},
+	}
+
+	var seen *User
+	page := s.authenticate(s.require(RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+		seen = userFrom(r)
+		s.render(w, r, http.StatusOK, listTemplate, viewData{
+			Contacts: []*Contact{{ID: "cn=Jane,ou=contacts,dc=example,dc=org", Name: "Jane"}},
+			Request:  r,
+		})
+	}))
+	for _, tc := range []struct {
+		user string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		// Users who are not cached are looked up in the unreachable directory.
+		{"nobody", http.StatusServiceUnavailable},
+		{"vera", http.StatusForbidden},
+		{"eddie", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", "/contacts/edit", nil)
+		if tc.user != "" {
+			r.SetBasicAuth(tc.user, "secret")
+		}
+		rec := httptest.NewRecorder()
+		page.ServeHTTP(rec, r)
+		if rec.Code != tc.want {
+			t.Errorf("%q: status = %d, want %d", tc.user, rec.Code, tc.want)
+		}
+		if tc.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: no authentication challenge", tc.user)
+		}
+	}
+	if seen == nil || seen.Name != "eddie" {
+		t.Fatalf("user = %+v", seen)
+	}
+
+	r := httptest.NewRequest("GET", "/contacts/edit", nil)
+	r.SetBasicAuth("eddie", "secret")
+	rec := httptest.NewRecorder()
+	page.ServeHTTP(rec, r)
+	body := rec.Body.String()
+	if !strings.Contains(body, ">edit</a>") || strings.Contains(body, ">delete</a>") ||
+		strings.Contains(body, ">Webhooks</a>") || !strings.Contains(body, "Signed in as eddie") {
+		t.Errorf("editor page:\n%s", body)
+	}
+
+	api := s.authenticate(http.HandlerFunc(s.handleAPI))
+	r = httptest.NewRequest("DELETE", "/contacts/api/v1/contacts/1234", nil)
+	r.SetBasicAuth("eddie", "secret")
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("api delete = %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,108 @@
+package contacts
+
+import (
+	"sync"
+	"time"
+)
+
+// contactCacheAge bounds how long listed contacts are reused, so that
+// changes made by other directory clients show up even when the directory
+// is not being watched.
+const contactCacheAge = time.Minute
+
+// contactCacheMissAge is how old cached contacts must be before looking up
+// an unknown UUID lists them again, in case another client created it.
+const contactCacheMissAge = 5 * time.Second
+
+// contactCache holds the contacts listed from the directory, and the WebDAV
+// trees built from them, until a change is published or they grow old.
+type contactCache struct {
+	mu      sync.Mutex
+	seq     uint64
+	loaded  time.Time
+	records []*Contact
+	byUUID  map[string]*Contact
+	trees   map[bool]davTree
+}
+
+// refresh lists the contacts again unless the cached ones are current. The
+// caller must hold c.mu.
+func (c *contactCache) refresh(config Config) error {
+	seq := changeEvents.latest()
+	if c.records != nil && c.seq == seq && time.Since(c.loaded) < contactCacheAge {
+		return nil
+	}
+	records, err := List(config, nil)
+	if err != nil {
+		return err
+	}
+	c.seq, c.loaded, c.records, c.trees = seq, time.Now(), records, nil
+	c.byUUID = make(map[string]*Contact, len(records))
+	for _, contact := range records {
+		c.byUUID[contact.UUID()] = contact
+	}
+	return nil
+}
+
+// contactByUUID returns a copy of the contact whose UUID is id, found in an
+// index of the cached contacts rather than by listing the directory.
+func (s *server) contactByUUID(id string) (*Contact, error) {
+	c := s.contacts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(s.config); err != nil {
+		return nil, err
+	}
+	contact, ok := c.byUUID[id]
+	if !ok && time.Since(c.loaded) >= contactCacheMissAge {
+		c.records = nil
+		if err := c.refresh(s.config); err != nil {
+			return nil, err
+		}
+		contact, ok = c.byUUID[id]
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyContact(contact), nil
+}
+
+// copyContact returns a copy of c that shares no slices or maps with it, so
+// that it can be changed without changing the cache.
+func copyContact(c *Contact) *Contact {
+	copied := *c
+	for _, list := range []*[]string{&copied.Nickname, &copied.Email, &copied.Phone, &copied.Labels, &copied.Street} {
+		*list = append([]string(nil), *list...)
+	}
+	if c.Extra != nil {
+		copied.Extra = make(map[string][]string, len(c.Extra))
+		for k, v := range c.Extra {
+			copied.Extra[k] = append([]string(nil), v...)
+		}
+	}
+	return &copied
+}
+
+// davTree returns the WebDAV tree of the current contacts, built once for
+// each set of contacts and kept until they change. Trees are shared between
+// requests and must not be modified.
+func (s *server) davTree(readOnly bool) (davTree, error) {
+	c := s.contacts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(s.config); err != nil {
+		return nil, err
+	}
+	if tree, ok := c.trees[readOnly]; ok {
+		return tree, nil
+	}
+	tree := s.buildDAVTree(c.records)
+	if readOnly {
+		tree.readOnly()
+	}
+	if c.trees == nil {
+		c.trees = map[bool]davTree{}
+	}
+	c.trees[readOnly] = tree
+	return tree, nil
+}
@@ -0,0 +1,105 @@
+package contacts
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+const (
+	davCalendars = "calendars/"
+
+	birthdayCalendar = "birthdays"
+
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+)
+
+func init() { davPrefixes[nsCalDAV] = "cal" }
+
+// addCalendars adds the calendar home with the read-only calendar of
+// birthdays. Each birthday is its own resource, rendered as of the start
+// of the current year so that its ETag only changes when the contact's
+// name or birthday does, or the ages shown roll over at the new year.
+func (s *server) addCalendars(tree davTree, root, principal *davResource, records []*Contact, now time.Time) {
+	home := tree.add(root, s.davCollection(davCalendars, "Calendars"))
+	principal.props[davName(nsCalDAV, "calendar-home-set")] = s.davHref(davCalendars)
+
+	calendar := tree.add(home, s.davCollection(davCalendars+birthdayCalendar+"/", "Birthdays"))
+	calendar.props[davName(nsDAV, "resourcetype")] = "<d:collection/><cal:calendar/>"
+	calendar.props[davName(nsDAV, "current-user-privilege-set")] = "<d:privilege><d:read/></d:privilege>"
+	calendar.props[davName(nsDAV, "supported-report-set")] = davSupportedReports(
+		davName(nsCalDAV, "calendar-multiget"),
+		davName(nsCalDAV, "calendar-query"),
+		davName(nsDAV, "sync-collection"))
+	calendar.props[davName(nsCalDAV, "calendar-description")] = "Birthdays of contacts"
+	calendar.props[davName(nsCalDAV, "supported-calendar-component-set")] = `<cal:comp name="VEVENT"/>`
+
+	asOf := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, contact := range records {
+		if contact.Birthday.IsZero() {
+			continue
+		}
+		var b bytes.Buffer
+		if err := WriteICS(&b, "Birthdays", []*Contact{contact}, asOf); err != nil {
+			continue
+		}
+		member := tree.add(calendar, s.davMember(calendar, contact.UUID()+"-birthday.ics"))
+		member.contact = contact
+		member.props[davName(nsDAV, "current-user-privilege-set")] = "<d:privilege><d:read/></d:privilege>"
+		member.setContent(b.String(), "text/calendar; charset=utf-8; component=VEVENT")
+	}
+	s.davSync(calendar)
+}
+
+// calendarQuery answers a calendar-query report on the birthday calendar.
+// Only the time-range of a VEVENT comp-filter is applied; every event is a
+// birthday, so other filters match all of them.
+func (s *server) calendarQuery(w http.ResponseWriter, r *http.Request, res *davResource, body davNode) {
+	if res.path != davCalendars+birthdayCalendar+"/" {
+		writeDAVError(w, http.StatusForbidden, davName(nsDAV, "supported-report"))
+		return
+	}
+	var start, end time.Time
+	filter, _ := body.child(nsCalDAV, "filter")
+	calendar, _ := filter.child(nsCalDAV, "comp-filter")
+	event, _ := calendar.child(nsCalDAV, "comp-filter")
+	if timeRange, ok := event.child(nsCalDAV, "time-range"); ok {
+		start, _ = time.Parse(icsDateTime, timeRange.attr("start", ""))
+		end, _ = time.Parse(icsDateTime, timeRange.attr("end", ""))
+	}
+	var responses []string
+	for _, member := range res.children {
+		if member.contact != nil && birthdayBetween(member.contact.Birthday, start, end) {
+			responses = append(responses, s.davPropResponse(member, body))
+		}
+	}
+	writeMultistatus(w, responses, "")
+}
+
+// birthdayBetween reports whether an all-day occurrence of a birthday
+// overlaps the range from start to end, either of which may be zero for no
+// limit.
+func birthdayBetween(birthday, start, end time.Time) bool {
+	first := birthday.Year()
+	if first == 0 {
+		first = icsYearlessStart
+	}
+	if start.IsZero() || start.Year() < first {
+		start = time.Date(first, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	switch {
+	case end.IsZero():
+		return true
+	case !end.After(start):
+		return false
+	case !end.Before(start.AddDate(1, 0, 0)):
+		return true
+	}
+	for year := start.Year(); year <= end.Year(); year++ {
+		date := occurrenceIn(birthday, year)
+		if date.Before(end) && date.AddDate(0, 0, 1).After(start) {
+			return true
+		}
+	}
+	return false
+}
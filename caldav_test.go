@@ -0,0 +1,88 @@
+package contacts
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBirthdayCalendarETags(t *testing.T) {
+	s := &server{baseRoute: "/contacts/", dav: &davState{}}
+	jane := &Contact{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe", Birthday: time.Date(1980, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	noBirthday := &Contact{ID: "cn=John Roe,ou=contacts,dc=example", Name: "John Roe"}
+	etag := func(c *Contact, now time.Time) string {
+		tree := davTree{}
+		root := tree.add(nil, s.davCollection("", "Contacts"))
+		s.addCalendars(tree, root, root, []*Contact{c, noBirthday}, now)
+		calendar := tree[davCalendars+birthdayCalendar+"/"]
+		if len(calendar.children) != 1 {
+			t.Fatalf("calendar has %d events", len(calendar.children))
+		}
+		return calendar.children[0].etag
+	}
+
+	march := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	base := etag(jane, march)
+	if got := etag(jane, march.AddDate(0, 6, 0)); got != base {
+		t.Errorf("etag changed within the year: %s != %s", got, base)
+	}
+	renamed := *jane
+	renamed.Name = "Jane Roe"
+	if etag(&renamed, march) == base {
+		t.Error("etag did not change with the name")
+	}
+	moved := *jane
+	moved.Birthday = moved.Birthday.AddDate(0, 0, 1)
+	if etag(&moved, march) == base {
+		t.Error("etag did not change with the birthday")
+	}
+}
+
+func TestBirthdayBetween(t *testing.T) {
+	birthday := time.Date(1980, time.March, 4, 0, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		start, end time.Time
+		want       bool
+	}{
+		{time.Time{}, time.Time{}, true},
+		{day(2026, time.March, 1), day(2026, time.March, 8), true},
+		{day(2026, time.March, 5), day(2026, time.April, 1), false},
+		{day(2026, time.December, 1), day(2027, time.March, 5), true},
+		{day(1970, time.January, 1), day(1975, time.January, 1), false},
+	} {
+		if got := birthdayBetween(birthday, tc.start, tc.end); got != tc.want {
+			t.Errorf("birthdayBetween(%s, %s) = %t, want %t", tc.start.Format(icsDate), tc.end.Format(icsDate), got, tc.want)
+		}
+	}
+
+	leapling := time.Date(0, time.February, 29, 0, 0, 0, 0, time.UTC)
+	if !birthdayBetween(leapling, day(1972, time.February, 29), day(1972, time.March, 1)) {
+		t.Error("year-less leap day birthday missing from 1972")
+	}
+	if !birthdayBetween(leapling, day(2027, time.February, 28), day(2027, time.March, 1)) {
+		t.Error("year-less leap day birthday missing from February 28 in a common year")
+	}
+}
+
+func TestCalendarQuery(t *testing.T) {
+	s := &server{baseRoute: "/contacts/", dav: &davState{}}
+	jane := &Contact{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe", Birthday: time.Date(1980, time.March, 4, 0, 0, 0, 0, time.UTC)}
+	tree := davTree{}
+	root := tree.add(nil, s.davCollection("", "Contacts"))
+	s.addCalendars(tree, root, root, []*Contact{jane}, time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/></D:prop>` +
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">` +
+		`<C:time-range start="20260301T000000Z" end="20260308T000000Z"/></C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+	for _, p := range []string{davCalendars, davCalendars + birthdayCalendar + "/" + jane.UUID() + "-birthday.ics"} {
+		if w := davRequest(s, tree, tree[p], "REPORT", "1", query); w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d", p, w.Code)
+		}
+	}
+	w := davRequest(s, tree, tree[davCalendars+birthdayCalendar+"/"], "REPORT", "1", query)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), jane.UUID()+"-birthday.ics") {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
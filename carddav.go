@@ -0,0 +1,342 @@
+package contacts
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	davAddressBooks = "addressbooks/"
+
+	allAddressBook      = "all"
+	labelAddressBookTag = "label-"
+)
+
+// addressBook is a CardDAV collection: every contact, or the contacts with
+// a label.
+type addressBook struct {
+	Label string
+}
+
+func (b *addressBook) name() string {
+	if b.Label == "" {
+		return allAddressBook
+	}
+	return labelAddressBookTag + b.Label
+}
+
+func (b *addressBook) displayName() string {
+	if b.Label == "" {
+		return "All Contacts"
+	}
+	return b.Label
+}
+
+func (b *addressBook) includes(c *Contact) bool {
+	if b.Label == "" {
+		return true
+	}
+	for _, label := range c.Labels {
+		if label == b.Label {
+			return true
+		}
+	}
+	return false
+}
+
+// addAddressBooks adds the addressbook home with a collection of every
+// contact and one collection per label.
+func (s *server) addAddressBooks(tree davTree, root, principal *davResource, records []*Contact) {
+	home := tree.add(root, s.davCollection(davAddressBooks, "Address Books"))
+	principal.props[davName(nsCardDAV, "addressbook-home-set")] = s.davHref(davAddressBooks)
+
+	books := []*addressBook{{}}
+	seen := map[string]bool{}
+	for _, contact := range records {
+		for _, label := range contact.Labels {
+			if !seen[label] {
+				seen[label] = true
+				books = append(books, &addressBook{Label: label})
+			}
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Label < books[j].Label })
+
+	for _, book := range books {
+		collection := tree.add(home, s.davCollection(davAddressBooks+url.PathEscape(book.name())+"/", book.displayName()))
+		collection.book = book
+		collection.props[davName(nsDAV, "resourcetype")] = "<d:collection/><card:addressbook/>"
+		collection.props[davName(nsDAV, "supported-report-set")] = davSupportedReports(
+			davName(nsCardDAV, "addressbook-multiget"),
+			davName(nsCardDAV, "addressbook-query"),
+			davName(nsDAV, "sync-collection"))
+		collection.props[davName(nsCardDAV, "addressbook-description")] = davEscape(book.displayName())
+		collection.props[davName(nsCardDAV, "supported-address-data")] = "" +
+			`<card:address-data-type content-type="text/vcard" version="3.0"/>` +
+			`<card:address-data-type content-type="text/vcard" version="4.0"/>`
+		collection.props[davName(nsCardDAV, "max-resource-size")] = strconv.Itoa(maxImportSize)
+		for _, contact := range records {
+			if !book.includes(contact) {
+				continue
+			}
+			member := tree.add(collection, s.davMember(collection, s.davContactName(contact)))
+			member.book, member.contact = book, contact
+			member.setContent(contact.VCard(VCard3, s.config.DefaultRegion), "text/vcard; charset=utf-8")
+		}
+		s.davSync(collection)
+	}
+}
+
+// davContactName is the name of the contact's resource in address books:
+// the one the client that created it chose, or one made from its UID.
+func (s *server) davContactName(c *Contact) string {
+	if name, ok := s.dav.name(c.ID); ok {
+		return name
+	}
+	if uids := c.ExtraValues(vcardUIDAttribute); len(uids) > 0 {
+		return uids[0] + ".vcf"
+	}
+	return c.UUID() + ".vcf"
+}
+
+// davPut creates or replaces the contact at p from the vCard in the body.
+// New contacts keep the UID of their vCard, and are served under the name
+// the client chose. Names other than the UID's are only remembered until
+// the server restarts, after which syncing clients see the contact move.
+func (s *server) davPut(w http.ResponseWriter, r *http.Request, tree davTree, p string) {
+	slash := strings.LastIndex(p, "/")
+	parent := tree[p[:slash+1]]
+	switch {
+	case strings.HasSuffix(p, "/") || slash < 0:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	case parent == nil:
+		http.Error(w, "Conflict", http.StatusConflict)
+		return
+	case parent.book == nil:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	existing := tree[p]
+	if !davPreconditions(r, existing) {
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	cards, err := ParseVCards(strings.NewReader(string(data)))
+	if err != nil || len(cards) != 1 {
+		log.Printf("dav put %q: %d cards, %v", p, len(cards), err)
+		writeDAVError(w, http.StatusForbidden, davName(nsCardDAV, "valid-address-data"))
+		return
+	}
+	updated := cards[0]
+	if book := parent.book; book.Label != "" && !book.includes(updated) {
+		updated.Labels = append(updated.Labels, book.Label)
+	}
+
+	var original *Contact
+	if existing != nil {
+		original = existing.contact
+		updated.ID, updated.CommonName, updated.Extra = original.ID, original.CommonName, original.Extra
+	} else if uid := readVCardUID(string(data)); uid != "" {
+		updated.Extra = map[string][]string{vcardUIDAttribute: {uid}}
+	}
+	err = Save(s.config, original, updated)
+	var errs ValidationErrors
+	switch {
+	case errors.As(err, &errs):
+		log.Printf("dav put %q: %v", p, errs)
+		writeDAVError(w, http.StatusForbidden, davName(nsCardDAV, "valid-address-data"))
+		return
+	case err != nil:
+		log.Printf("dav put %q: %v", p, err)
+		http.Error(w, http.StatusText(errorStatus(err)), errorStatus(err))
+		return
+	}
+	if existing == nil {
+		if name, err := url.PathUnescape(p[slash+1:]); err == nil && name != s.davContactName(updated) {
+			s.dav.setName(updated.ID, name)
+		}
+	}
+	if tree, err := s.davTree(false); err == nil && tree[p] != nil {
+		w.Header().Set("ETag", tree[p].etag)
+	}
+	if existing != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davDelete deletes a contact from the collection of every contact, and
+// removes the label from a contact in a label's collection.
+func (s *server) davDelete(w http.ResponseWriter, r *http.Request, res *davResource) {
+	switch {
+	case res.contact == nil:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	case res.book == nil:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	case allowed(r, RoleEditor) != nil,
+		res.book.Label == "" && allowed(r, RoleAdmin) != nil:
+		// Removing a label is an edit, removing from all is a delete.
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !davPreconditions(r, res) {
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		return
+	}
+	var err error
+	if res.book.Label == "" {
+		err = Delete(s.config, res.contact.ID)
+	} else {
+		updated := *res.contact
+		updated.Labels = nil
+		for _, label := range res.contact.Labels {
+			if label != res.book.Label {
+				updated.Labels = append(updated.Labels, label)
+			}
+		}
+		err = Save(s.config, res.contact, &updated)
+	}
+	if err != nil {
+		log.Printf("dav delete %q: %v", res.path, err)
+		http.Error(w, http.StatusText(errorStatus(err)), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addressBookQuery answers an addressbook-query report with the contacts
+// of the collection matching the filter in body.
+func (s *server) addressBookQuery(w http.ResponseWriter, r *http.Request, res *davResource, body davNode) {
+	if res.book == nil || res.contact != nil {
+		writeDAVError(w, http.StatusForbidden, davName(nsDAV, "supported-report"))
+		return
+	}
+	filter, _ := body.child(nsCardDAV, "filter")
+	limit := -1
+	if l, ok := body.child(nsCardDAV, "limit"); ok {
+		if n, ok := l.child(nsCardDAV, "nresults"); ok {
+			if v, err := strconv.Atoi(strings.TrimSpace(n.Text)); err == nil && v >= 0 {
+				limit = v
+			}
+		}
+	}
+	var responses []string
+	for _, member := range res.children {
+		if !matchesAddressBookFilter(member.body, filter) {
+			continue
+		}
+		if len(responses) == limit {
+			responses = append(responses, davStatus(s.davHref(res.path), http.StatusInsufficientStorage))
+			break
+		}
+		responses = append(responses, s.davPropResponse(member, body))
+	}
+	writeMultistatus(w, responses, "")
+}
+
+// davPreconditions checks the If-Match and If-None-Match headers of r
+// against res, which is nil if it does not exist yet.
+func davPreconditions(r *http.Request, res *davResource) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if res == nil || (match != "*" && match != res.etag) {
+			return false
+		}
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && res != nil {
+		if match == "*" || match == res.etag {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAddressBookFilter reports whether the vCard card matches the
+// CardDAV filter element, which is empty if the query has none.
+func matchesAddressBookFilter(card string, filter davNode) bool {
+	filters := filter.all(nsCardDAV, "prop-filter")
+	if len(filters) == 0 {
+		return true
+	}
+	lines, _ := unfoldLines(strings.NewReader(card))
+	props := map[string][]string{}
+	for _, line := range lines {
+		if prop, ok := parseVCardLine(line); ok {
+			props[prop.Name] = append(props[prop.Name], unescapeVCard(prop.Value))
+		}
+	}
+	allOf := filter.attr("test", "anyof") == "allof"
+	for _, f := range filters {
+		if matched := matchesPropFilter(props, f); matched != allOf {
+			return matched
+		}
+	}
+	return allOf
+}
+
+func matchesPropFilter(props map[string][]string, filter davNode) bool {
+	values, defined := props[strings.ToUpper(filter.attr("name", ""))]
+	if _, ok := filter.child(nsCardDAV, "is-not-defined"); ok {
+		return !defined
+	}
+	matches := filter.all(nsCardDAV, "text-match")
+	if len(matches) == 0 || !defined {
+		return defined
+	}
+	allOf := filter.attr("test", "anyof") == "allof"
+	for _, m := range matches {
+		if matched := textMatches(values, m); matched != allOf {
+			return matched
+		}
+	}
+	return allOf
+}
+
+// textMatches applies a text-match element case insensitively to values.
+func textMatches(values []string, match davNode) bool {
+	term := strings.ToLower(match.Text)
+	negate := match.attr("negate-condition", "no") == "yes"
+	for _, value := range values {
+		value = strings.ToLower(value)
+		var hit bool
+		switch match.attr("match-type", "contains") {
+		case "equals":
+			hit = value == term
+		case "starts-with":
+			hit = strings.HasPrefix(value, term)
+		case "ends-with":
+			hit = strings.HasSuffix(value, term)
+		default:
+			hit = strings.Contains(value, term)
+		}
+		if hit {
+			return !negate
+		}
+	}
+	return negate
+}
+
+func davSupportedReports(reports ...xml.Name) string {
+	var b strings.Builder
+	for _, report := range reports {
+		fmt.Fprintf(&b, "<d:supported-report><d:report>%s</d:report></d:supported-report>", davElement(report, ""))
+	}
+	return b.String()
+}
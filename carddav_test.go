@@ -0,0 +1,156 @@
+package contacts
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDAVTree() (*server, davTree) {
+	s := &server{baseRoute: "/contacts/", dav: &davState{}}
+	records := []*Contact{
+		{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe", Email: []string{"jane@example.com"}, Labels: []string{"family"}},
+		{ID: "cn=John Roe,ou=contacts,dc=example", Name: "John Roe", Email: []string{"john@example.org"}},
+	}
+	return s, s.buildDAVTree(records)
+}
+
+func davRequest(s *server, tree davTree, res *davResource, method, depth, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/contacts/dav/"+res.path, strings.NewReader(body))
+	if depth != "" {
+		r.Header.Set("Depth", depth)
+	}
+	w := httptest.NewRecorder()
+	switch method {
+	case "PROPFIND":
+		s.davPropfind(w, r, res)
+	case "REPORT":
+		s.davReport(w, r, tree, res)
+	}
+	return w
+}
+
+func TestDAVTree(t *testing.T) {
+	s, tree := testDAVTree()
+	for _, p := range []string{"", "principal/", "addressbooks/", "addressbooks/all/", "addressbooks/label-family/"} {
+		if tree[p] == nil {
+			t.Fatalf("missing %q", p)
+		}
+	}
+	if got := len(tree["addressbooks/label-family/"].children); got != 1 {
+		t.Errorf("family book has %d contacts", got)
+	}
+
+	w := davRequest(s, tree, tree["principal/"], "PROPFIND", "0",
+		`<propfind xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><prop><C:addressbook-home-set/><getctag xmlns="http://calendarserver.org/ns/"/></prop></propfind>`)
+	body := w.Body.String()
+	if w.Code != http.StatusMultiStatus ||
+		!strings.Contains(body, "<card:addressbook-home-set><d:href>/contacts/dav/addressbooks/</d:href></card:addressbook-home-set>") ||
+		!strings.Contains(body, "<cs:getctag/></d:prop><d:status>HTTP/1.1 404 Not Found") {
+		t.Errorf("propfind principal: %d\n%s", w.Code, body)
+	}
+
+	w = davRequest(s, tree, tree["addressbooks/"], "PROPFIND", "1", "")
+	if got := strings.Count(w.Body.String(), "<card:addressbook/>"); got != 2 {
+		t.Errorf("home lists %d address books\n%s", got, w.Body.String())
+	}
+}
+
+func TestDAVReports(t *testing.T) {
+	s, tree := testDAVTree()
+	all := tree["addressbooks/all/"]
+
+	w := davRequest(s, tree, all, "REPORT", "1", `<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+<D:prop><D:getetag/><C:address-data/></D:prop>
+<C:filter><C:prop-filter name="EMAIL"><C:text-match match-type="ends-with">.org</C:text-match></C:prop-filter></C:filter>
+</C:addressbook-query>`)
+	if body := w.Body.String(); strings.Count(body, "<d:response>") != 1 || !strings.Contains(body, "FN:John Roe") {
+		t.Errorf("query:\n%s", body)
+	}
+
+	token := all.props[davName(nsDAV, "sync-token")]
+	w = davRequest(s, tree, all, "REPORT", "", `<sync-collection xmlns="DAV:"><sync-token>`+token+`</sync-token><prop><getetag/></prop></sync-collection>`)
+	if body := w.Body.String(); strings.Contains(body, "<d:response>") || !strings.Contains(body, token) {
+		t.Errorf("sync without changes:\n%s", body)
+	}
+
+	w = davRequest(s, tree, all, "REPORT", "", `<sync-collection xmlns="DAV:"><sync-token>data:,unknown</sync-token></sync-collection>`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "valid-sync-token") {
+		t.Errorf("unknown token: %d\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestMatchesAddressBookFilter(t *testing.T) {
+	card := (&Contact{Name: "Jane Doe", Email: []string{"jane@example.com"}}).VCard(VCard3, "")
+	for filter, want := range map[string]bool{
+		``: true,
+		`<C:filter><C:prop-filter name="FN"><C:text-match>jane</C:text-match></C:prop-filter></C:filter>`:                                    true,
+		`<C:filter><C:prop-filter name="FN"><C:text-match negate-condition="yes">jane</C:text-match></C:prop-filter></C:filter>`:             false,
+		`<C:filter><C:prop-filter name="TEL"><C:is-not-defined/></C:prop-filter></C:filter>`:                                                 true,
+		`<C:filter test="allof"><C:prop-filter name="FN"/><C:prop-filter name="TEL"/></C:filter>`:                                            false,
+		`<C:filter><C:prop-filter name="EMAIL"><C:text-match match-type="equals">JANE@EXAMPLE.COM</C:text-match></C:prop-filter></C:filter>`: true,
+	} {
+		var query davNode
+		if err := xml.Unmarshal([]byte(`<C:addressbook-query xmlns:C="urn:ietf:params:xml:ns:carddav">`+filter+`</C:addressbook-query>`), &query); err != nil {
+			t.Fatal(err)
+		}
+		f, _ := query.child(nsCardDAV, "filter")
+		if got := matchesAddressBookFilter(card, f); got != want {
+			t.Errorf("%s = %t, want %t", filter, got, want)
+		}
+	}
+}
+
+func TestDAVContactNames(t *testing.T) {
+	s, _ := testDAVTree()
+	created := &Contact{ID: "cn=Mary Major,ou=contacts,dc=example", Name: "Mary Major",
+		Extra: map[string][]string{vcardUIDAttribute: {"4D1E-77B2"}}}
+	chosen := &Contact{ID: "cn=Max Mustermann,ou=contacts,dc=example", Name: "Max Mustermann"}
+	s.dav.setName(chosen.ID, "client chosen.vcf")
+	tree := s.buildDAVTree([]*Contact{created, chosen})
+
+	res := tree["addressbooks/all/4D1E-77B2.vcf"]
+	if res == nil || !strings.Contains(res.body, "UID:4D1E-77B2\r\n") {
+		t.Errorf("contact with a UID not served under it: %+v", res)
+	}
+	if tree["addressbooks/all/client%20chosen.vcf"] == nil {
+		t.Error("contact not served under the name the client chose")
+	}
+
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:4D1E-77B2\r\nFN:Mary Major\r\nEND:VCARD\r\n"
+	if got := readVCardUID(card); got != "4D1E-77B2" {
+		t.Errorf("readVCardUID = %q", got)
+	}
+}
+
+func TestDAVTreeCache(t *testing.T) {
+	s := &server{baseRoute: "/contacts/", dav: &davState{}, contacts: &contactCache{
+		seq:     changeEvents.latest(),
+		loaded:  time.Now(),
+		records: []*Contact{{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe"}},
+	}}
+	// The directory is unreachable, so only cached trees can be returned.
+	s.config = Config{Host: "127.0.0.1", Port: "1"}
+	first, err := s.davTree(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := s.davTree(false)
+	readOnly, _ := s.davTree(true)
+	if len(first) == 0 || fmt.Sprintf("%p", first) != fmt.Sprintf("%p", again) {
+		t.Error("tree rebuilt without a change")
+	}
+	if fmt.Sprintf("%p", readOnly) == fmt.Sprintf("%p", first) ||
+		strings.Contains(readOnly[""].props[davName(nsDAV, "current-user-privilege-set")], "write") {
+		t.Error("read-only tree shared with editors")
+	}
+
+	changeEvents.publish(WebhookUpdate, ChangeFromServer, s.contacts.records[0])
+	if _, err := s.davTree(false); err == nil {
+		t.Error("tree reused after a change")
+	}
+}
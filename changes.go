@@ -0,0 +1,162 @@
+package contacts
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// ChangeFromServer marks changes written through this package.
+	ChangeFromServer = "server"
+	// ChangeFromDirectory marks changes found by WatchDirectory.
+	ChangeFromDirectory = "directory"
+
+	maxRecentChanges     = 100
+	changeSubscriberSize = 16
+)
+
+// ChangeEvent describes a contact that was created, updated or deleted.
+type ChangeEvent struct {
+	Seq    uint64    `json:"seq"`
+	Type   string    `json:"type"`
+	ID     string    `json:"id"`
+	Name   string    `json:"name"`
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+}
+
+type changeFeed struct {
+	mu          sync.Mutex
+	seq         uint64
+	recent      []ChangeEvent
+	subscribers map[chan ChangeEvent]bool
+}
+
+var changeEvents = &changeFeed{subscribers: map[chan ChangeEvent]bool{}}
+
+// SubscribeChanges returns a channel of future changes, the recent changes
+// after since, and a function that ends the subscription. Changes are
+// dropped for subscribers that fall behind.
+func SubscribeChanges(since uint64) (<-chan ChangeEvent, []ChangeEvent, func()) {
+	f := changeEvents
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan ChangeEvent, changeSubscriberSize)
+	f.subscribers[ch] = true
+	var missed []ChangeEvent
+	for _, e := range f.recent {
+		if since > 0 && e.Seq > since {
+			missed = append(missed, e)
+		}
+	}
+	return ch, missed, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.subscribers[ch] {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// CloseChangeSubscriptions ends every subscription, finishing the event
+// streams being served so that the server can shut down.
+func CloseChangeSubscriptions() {
+	f := changeEvents
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (f *changeFeed) publish(event, source string, c *Contact) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	e := ChangeEvent{
+		Seq:    f.seq,
+		Type:   event,
+		ID:     c.UUID(),
+		Name:   c.DisplayName(),
+		Source: source,
+		Time:   time.Now().UTC(),
+	}
+	f.recent = append(f.recent, e)
+	if len(f.recent) > maxRecentChanges {
+		f.recent = f.recent[len(f.recent)-maxRecentChanges:]
+	}
+	for ch := range f.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// latest is the sequence number of the most recent change.
+func (f *changeFeed) latest() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// contactChanged announces a successful write to webhooks and change
+// subscribers.
+func contactChanged(config Config, event string, c *Contact, changes map[string]map[string][]string) {
+	changeEvents.publish(event, ChangeFromServer, c)
+	notifyWebhooks(config, event, c, changes)
+}
+
+// WatchDirectory polls the directory every interval until stop is closed,
+// publishing the changes made by other directory clients.
+func WatchDirectory(config Config, interval time.Duration, stop <-chan struct{}) {
+	var previous map[string]*Contact
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		records, err := List(config, nil)
+		if err != nil {
+			log.Printf("watching directory: %v", err)
+		} else {
+			current := map[string]*Contact{}
+			for _, contact := range records {
+				current[contact.UUID()] = contact
+			}
+			if previous != nil {
+				publishDifferences(previous, current)
+			}
+			previous = current
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func publishDifferences(previous, current map[string]*Contact) {
+	for id, contact := range current {
+		before, ok := previous[id]
+		switch {
+		case !ok:
+			changeEvents.publish(WebhookCreate, ChangeFromDirectory, contact)
+		case contactHash(before) != contactHash(contact):
+			changeEvents.publish(WebhookUpdate, ChangeFromDirectory, contact)
+		}
+	}
+	for id, contact := range previous {
+		if _, ok := current[id]; !ok {
+			changeEvents.publish(WebhookDelete, ChangeFromDirectory, contact)
+		}
+	}
+}
+
+func contactHash(c *Contact) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprint(c.managedValues(c.Extra)))))
+}
@@ -0,0 +1,80 @@
+package contacts
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamEvents(t *testing.T) {
+	s := &server{baseRoute: "/contacts/"}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(s.streamEvents))
+	// Streams must outlast the server's timeouts.
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	jane := &Contact{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe"}
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type = %q", ct)
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		changeEvents.publish(WebhookUpdate, ChangeFromServer, jane)
+	}()
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	for {
+		select {
+		case line := <-lines:
+			if line == "event: update" {
+				if data := <-lines; !strings.Contains(data, `"id":"`+jane.UUID()+`"`) {
+					t.Errorf("data = %s", data)
+				}
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update event")
+		}
+	}
+}
+
+func TestPublishDifferences(t *testing.T) {
+	events, _, cancel := SubscribeChanges(0)
+	defer cancel()
+	a := &Contact{ID: "cn=A", Name: "A"}
+	b := &Contact{ID: "cn=B", Name: "B"}
+	b2 := &Contact{ID: "cn=B", Name: "B", Email: []string{"b@example.com"}}
+	c := &Contact{ID: "cn=C", Name: "C"}
+	publishDifferences(
+		map[string]*Contact{a.UUID(): a, b.UUID(): b},
+		map[string]*Contact{b.UUID(): b2, c.UUID(): c})
+
+	got := map[string]string{}
+	for i := 0; i < 3; i++ {
+		e := <-events
+		got[e.Name] = e.Type
+		if e.Source != ChangeFromDirectory {
+			t.Errorf("source = %q", e.Source)
+		}
+	}
+	if got["A"] != WebhookDelete || got["B"] != WebhookUpdate || got["C"] != WebhookCreate {
+		t.Errorf("events = %v", got)
+	}
+}
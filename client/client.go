@@ -0,0 +1,224 @@
+// Package client is a Go client for the contacts JSON API served by
+// contacts.NewWebServer.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"jw4.us/contacts"
+)
+
+// Client talks to the API below BaseURL, e.g. "https://example.com/contacts/".
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Username and Password sign in to servers that require it.
+	Username string
+	Password string
+}
+
+// New returns a Client for the server whose contacts base route is baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+// Filter narrows the contacts returned by List.
+type Filter struct {
+	Labels []string
+	Query  string
+	// Sort is one of "", "last", "phonetic" or "phonetic-last".
+	Sort string
+}
+
+// Error is returned for every API response that is not a success. It
+// unwraps to contacts.ErrNotFound for 404 responses and to the field
+// errors as contacts.ValidationErrors for 422 responses.
+type Error struct {
+	StatusCode int
+	Message    string
+	Fields     map[string]string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("contacts api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return contacts.ErrNotFound
+	case len(e.Fields) > 0:
+		return contacts.ValidationErrors(e.Fields)
+	}
+	return nil
+}
+
+// List returns the contacts matching filter. The ID of every contact is its
+// API ID.
+func (c *Client) List(ctx context.Context, filter Filter) ([]*contacts.Contact, error) {
+	v := url.Values{}
+	for _, label := range filter.Labels {
+		v.Add("label", label)
+	}
+	if filter.Query != "" {
+		v.Set("q", filter.Query)
+	}
+	if filter.Sort != "" {
+		v.Set("sort", filter.Sort)
+	}
+	var list []contacts.APIContact
+	if err := c.do(ctx, "GET", "contacts", v, nil, &list); err != nil {
+		return nil, err
+	}
+	records := make([]*contacts.Contact, 0, len(list))
+	for _, a := range list {
+		contact, err := a.Contact()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, contact)
+	}
+	return records, nil
+}
+
+// Get returns the contact with the API id.
+func (c *Client) Get(ctx context.Context, id string) (*contacts.Contact, error) {
+	return c.contact(ctx, "GET", "contacts/"+url.PathEscape(id), nil)
+}
+
+// Create creates contact and returns it as stored, with its new API ID.
+func (c *Client) Create(ctx context.Context, contact *contacts.Contact) (*contacts.Contact, error) {
+	a := contacts.NewAPIContact(contact)
+	a.ID = ""
+	return c.contact(ctx, "POST", "contacts", a)
+}
+
+// Update replaces every field of the contact whose API ID is contact.ID
+// with the values of contact, clearing the fields that are empty.
+func (c *Client) Update(ctx context.Context, contact *contacts.Contact) (*contacts.Contact, error) {
+	fields, err := allFields(contacts.NewAPIContact(contact))
+	if err != nil {
+		return nil, err
+	}
+	return c.Patch(ctx, contact.ID, fields)
+}
+
+// Patch changes only the fields of the contact with the API id that are
+// present in fields, keyed by their JSON names.
+func (c *Client) Patch(ctx context.Context, id string, fields map[string]interface{}) (*contacts.Contact, error) {
+	return c.contact(ctx, "PATCH", "contacts/"+url.PathEscape(id), fields)
+}
+
+// Delete deletes the contact with the API id.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "contacts/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Labels returns every label in use along with the number of contacts
+// having it.
+func (c *Client) Labels(ctx context.Context) ([]contacts.APILabel, error) {
+	var labels []contacts.APILabel
+	if err := c.do(ctx, "GET", "labels", nil, nil, &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (c *Client) contact(ctx context.Context, method, endpoint string, body interface{}) (*contacts.Contact, error) {
+	var a contacts.APIContact
+	if err := c.do(ctx, method, endpoint, nil, body, &a); err != nil {
+		return nil, err
+	}
+	return a.Contact()
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, query url.Values, body, result interface{}) error {
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/api/v1/" + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var in io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		in = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, in)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		var body contacts.APIError
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			apiErr.Message, apiErr.Fields = body.Error, body.Fields
+		}
+		return apiErr
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// allFields returns the JSON fields of a, other than its ID, including the
+// empty ones that its omitempty tags would leave out.
+func allFields(a contacts.APIContact) (map[string]interface{}, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(a)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if _, ok := fields[name]; ok || name == "id" {
+			continue
+		}
+		if t.Field(i).Type.Kind() == reflect.Slice {
+			fields[name] = []string{}
+		} else {
+			fields[name] = ""
+		}
+	}
+	delete(fields, "id")
+	return fields, nil
+}
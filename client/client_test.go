@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"jw4.us/contacts"
+)
+
+func TestClient(t *testing.T) {
+	var patched map[string]interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/contacts/api/v1/contacts", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query()["label"]; len(got) != 1 || got[0] != "family" {
+			t.Errorf("label filter = %v", got)
+		}
+		json.NewEncoder(w).Encode([]contacts.APIContact{{ID: "id-1", Name: "Jane Doe", Birthday: "--03-04"}})
+	})
+	mux.HandleFunc("/contacts/api/v1/contacts/id-1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&patched)
+		json.NewEncoder(w).Encode(contacts.APIContact{ID: "id-1", Name: "Jane Roe"})
+	})
+	mux.HandleFunc("/contacts/api/v1/contacts/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(contacts.APIError{Error: "contact not found"})
+	})
+	mux.HandleFunc("/contacts/api/v1/contacts/invalid", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(contacts.APIError{Error: "invalid", Fields: map[string]string{"Email": "bad"}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := New(srv.URL + "/contacts/")
+	ctx := context.Background()
+
+	list, err := c.List(ctx, Filter{Labels: []string{"family"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != "id-1" || list[0].BirthDayOfMonth() != 4 {
+		t.Fatalf("list = %+v", list)
+	}
+
+	updated, err := c.Update(ctx, &contacts.Contact{ID: "id-1", Name: "Jane Roe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Jane Roe" {
+		t.Errorf("updated name = %q", updated.Name)
+	}
+	if v, ok := patched["email"]; !ok || len(v.([]interface{})) != 0 {
+		t.Errorf("update should clear email, sent %v", patched)
+	}
+	if _, ok := patched["id"]; ok {
+		t.Errorf("update should not send the id, sent %v", patched)
+	}
+
+	if _, err = c.Get(ctx, "missing"); !errors.Is(err, contacts.ErrNotFound) {
+		t.Errorf("get missing: %v", err)
+	}
+	var errs contacts.ValidationErrors
+	if _, err = c.Patch(ctx, "invalid", nil); !errors.As(err, &errs) || errs["Email"] != "bad" {
+		t.Errorf("patch invalid: %v", err)
+	}
+}
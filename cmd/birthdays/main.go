@@ -1,23 +1,38 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
-	"os"
 	"sort"
 
 	"jw4.us/contacts"
+	"jw4.us/contacts/client"
 )
 
 func main() {
-	config := contacts.Config{
-		Host:     os.Getenv("LDAP_HOST"),
-		Port:     os.Getenv("LDAP_PORT"),
-		Username: os.Getenv("LDAP_USER"),
-		Password: os.Getenv("LDAP_PASS"),
-		BaseDN:   os.Getenv("LDAP_BASE"),
+	loader := contacts.NewConfigLoader(flag.CommandLine)
+	server := loader.String("CONTACTS_SERVER", "server", "", "base URL of a contacts web server to use instead of LDAP")
+	serverUser := loader.String("CONTACTS_USER", "server-user", "", "user name to sign in to the server with")
+	serverPass := loader.Secret("CONTACTS_PASS", "server-pass", "password to sign in to the server with")
+	flag.Parse()
+
+	config, err := loader.Load()
+	if err == nil && *server == "" {
+		err = config.Validate()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	var records []*contacts.Contact
+	if *server != "" {
+		remote := client.New(*server)
+		remote.Username, remote.Password = *serverUser, *serverPass
+		records, err = remote.List(context.Background(), client.Filter{})
+	} else {
+		records, err = contacts.List(config, nil)
 	}
-	records, err := contacts.List(config, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
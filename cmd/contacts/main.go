@@ -1,28 +1,232 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"jw4.us/contacts"
+	"jw4.us/contacts/client"
 )
 
 func main() {
-	config := contacts.Config{
-		Host:     os.Getenv("LDAP_HOST"),
-		Port:     os.Getenv("LDAP_PORT"),
-		Username: os.Getenv("LDAP_USER"),
-		Password: os.Getenv("LDAP_PASS"),
-		BaseDN:   os.Getenv("LDAP_BASE"),
-	}
-	records, err := contacts.List(config, nil)
+	export := flag.String("export", "", "export format instead of listing: vcard, csv or ldif")
+	version := flag.String("vcard-version", contacts.VCard4, "vCard version to export: 3.0 or 4.0")
+	label := flag.String("label", "", "comma separated labels to filter by")
+	importFile := flag.String("import", "", "file of contacts to import, or - for stdin")
+	format := flag.String("format", "", "import format: vcard, csv or ldif (default from the file extension)")
+	preset := flag.String("preset", "", "csv column preset: "+strings.Join(contacts.CSVPresetNames(), ", "))
+	mapping := flag.String("map", "", "extra csv column mappings: Header=field,...")
+	dryRun := flag.Bool("dry-run", false, "report what an import would do without saving")
+	ldifMode := flag.String("ldif-mode", contacts.LDIFAdd, "how ldif content records are imported: add or modify")
+	loader := contacts.NewConfigLoader(flag.CommandLine)
+	server := loader.String("CONTACTS_SERVER", "server", "", "base URL of a contacts web server to use instead of LDAP")
+	serverUser := loader.String("CONTACTS_USER", "server-user", "", "user name to sign in to the server with")
+	serverPass := loader.Secret("CONTACTS_PASS", "server-pass", "password to sign in to the server with")
+	flag.Parse()
+
+	config, err := loader.Load()
+	if err == nil && *server == "" {
+		err = config.Validate()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var remote *client.Client
+	if *server != "" {
+		remote = client.New(*server)
+		remote.Username, remote.Password = *serverUser, *serverPass
+	}
+
+	if *importFile != "" {
+		runImport(config, remote, *importFile, *format, *preset, *mapping, *ldifMode, *dryRun)
+		return
+	}
+
+	var labels []string
+	if *label != "" {
+		labels = strings.Split(*label, ",")
+	}
+	if *export == "ldif" {
+		if remote != nil {
+			log.Fatal("ldif export needs direct LDAP access")
+		}
+		if err := contacts.ExportLDIF(config, os.Stdout, labels); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	records, err := list(config, remote, labels)
 	if err != nil {
 		log.Fatal(err)
 	}
 	sort.Sort(contacts.ByName(records))
-	for _, p := range records {
-		fmt.Printf("%30s %-40s %-20s %v\n", p.DisplayName(), p.Email, p.Phone, p.Labels)
+	switch *export {
+	case "":
+		for _, p := range records {
+			fmt.Printf("%30s %-40s %-20s %v\n", p.DisplayName(), p.Email, p.Phone, p.Labels)
+		}
+	case "vcard":
+		if err = contacts.WriteVCards(os.Stdout, *version, config.DefaultRegion, records...); err != nil {
+			log.Fatal(err)
+		}
+	case "csv":
+		if err = contacts.WriteCSV(os.Stdout, *preset, records...); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown export format %q", *export)
+	}
+}
+
+// list reads the contacts from remote if it is set, and from the directory
+// otherwise.
+func list(config contacts.Config, remote *client.Client, labels []string) ([]*contacts.Contact, error) {
+	if remote != nil {
+		return remote.List(context.Background(), client.Filter{Labels: labels})
+	}
+	return contacts.List(config, labels)
+}
+
+func runImport(config contacts.Config, remote *client.Client, name, format, preset, mapping, ldifMode string, dryRun bool) {
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	}
+
+	var (
+		incoming []*contacts.Contact
+		err      error
+	)
+	switch format {
+	case "csv":
+		columns, cerr := contacts.ParseCSVMapping(mapping)
+		if cerr != nil {
+			log.Fatal(cerr)
+		}
+		incoming, err = contacts.ReadCSV(in, preset, columns)
+	case "vcard", "vcf":
+		incoming, err = contacts.ParseVCards(in)
+	case "ldif":
+		if remote != nil {
+			log.Fatal("ldif import needs direct LDAP access")
+		}
+		runLDIFImport(config, in, ldifMode, dryRun)
+		return
+	default:
+		log.Fatalf("unknown import format %q", format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	existing, err := list(config, remote, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	items := contacts.PlanImportFrom(existing, incoming, config.DefaultRegion)
+	if !dryRun {
+		apply := contacts.ApplyImport
+		if remote != nil {
+			apply = func(_ contacts.Config, items []*contacts.ImportItem) (int, error) {
+				return applyRemote(remote, items)
+			}
+		}
+		if saved, err := apply(config, items); err != nil {
+			log.Printf("imported %d of %d: %v", saved, len(items), err)
+		}
+	}
+	for _, item := range items {
+		action := "update"
+		switch {
+		case item.Err != nil:
+			action = "error"
+		case item.Create():
+			action = "create"
+		case item.Unchanged():
+			action = "unchanged"
+		}
+		fmt.Printf("%-9s %s\n", action, item.Result.DisplayName())
+		if item.Err != nil {
+			fmt.Printf("          %v\n", item.Err)
+		}
+		for _, change := range item.ChangeSummary() {
+			fmt.Printf("          %s\n", change)
+		}
+	}
+}
+
+// applyRemote is contacts.ApplyImport through the API.
+func applyRemote(remote *client.Client, items []*contacts.ImportItem) (int, error) {
+	var (
+		saved    int
+		firstErr error
+	)
+	for _, item := range items {
+		if item.Err != nil || item.Unchanged() {
+			continue
+		}
+		var err error
+		if item.Create() {
+			_, err = remote.Create(context.Background(), item.Result)
+		} else {
+			_, err = remote.Update(context.Background(), item.Result)
+		}
+		if err != nil {
+			item.Err = err
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		saved++
+	}
+	return saved, firstErr
+}
+
+func runLDIFImport(config contacts.Config, in io.Reader, mode string, dryRun bool) {
+	if mode != contacts.LDIFAdd && mode != contacts.LDIFModify {
+		log.Fatalf("unknown ldif mode %q", mode)
+	}
+	records, err := contacts.ReadLDIF(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dryRun {
+		for _, record := range records {
+			fmt.Printf("%-9s %s\n", firstNonEmpty(record.ChangeType, mode), record.DN)
+		}
+		return
+	}
+	report, err := contacts.ImportLDIF(config, records, mode)
+	for _, line := range report {
+		fmt.Println(line)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val != "" {
+			return val
+		}
 	}
+	return ""
 }
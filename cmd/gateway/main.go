@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"jw4.us/contacts"
+)
+
+func main() {
+	addr := flag.String("listen", ":3389", "address to serve LDAP on")
+	file := flag.String("file", "", "vCard file to serve instead of the LDAP directory")
+	base := flag.String("base", "", "base DN to serve contacts below (default ou=contacts,$LDAP_BASE)")
+	loader := contacts.NewConfigLoader(flag.CommandLine)
+	bindDN := loader.String("GATEWAY_BIND_DN", "bind-dn", "", "DN clients must bind as (default anonymous access)")
+	bindPass := loader.Secret("GATEWAY_BIND_PASS", "bind-pass", "password clients must bind with")
+	flag.Parse()
+
+	config, err := loader.Load()
+	if err == nil && *file == "" {
+		err = config.Validate()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gateway := &contacts.Gateway{
+		BaseDN:    *base,
+		Source:    contacts.DirectorySource(config),
+		BindDN:    *bindDN,
+		Password:  *bindPass,
+		SizeLimit: 500,
+	}
+	if gateway.BaseDN == "" {
+		gateway.BaseDN = "ou=contacts," + config.BaseDN
+	}
+	if *file != "" {
+		gateway.Source = contacts.VCardFileSource(*file)
+	}
+
+	log.Printf("serving %s on %s", gateway.BaseDN, *addr)
+	log.Fatal(gateway.ListenAndServe(*addr))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"text/template"
+	"time"
+
+	"jw4.us/contacts"
+)
+
+type reminders []contacts.Reminder
+
+func (r *reminders) String() string { return "" }
+func (r *reminders) Set(spec string) error {
+	reminder, err := contacts.ParseReminder(spec)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, reminder)
+	return nil
+}
+
+func main() {
+	var specs reminders
+	flag.Var(&specs, "reminder", "labels:recipients:days, e.g. family:alice@example.com:14 (repeatable)")
+	at := flag.String("at", "08:00", "local time of day to send the digests")
+	once := flag.Bool("once", false, "send the digests now and exit")
+	templateFile := flag.String("template", "", "digest template file (default built in)")
+	loader := contacts.NewConfigLoader(flag.CommandLine)
+	from := loader.String("REMINDER_FROM", "from", "", "sender address")
+	smtpHost := loader.String("SMTP_HOST", "smtp-host", "", "SMTP server host name")
+	smtpPort := loader.String("SMTP_PORT", "smtp-port", "587", "SMTP server port")
+	smtpUser := loader.String("SMTP_USER", "smtp-user", "", "SMTP user name")
+	smtpPass := loader.Secret("SMTP_PASS", "smtp-pass", "SMTP password")
+	startTLS := loader.String("SMTP_STARTTLS", "smtp-starttls", "false", "require STARTTLS: true or false")
+	flag.Parse()
+
+	config, err := loader.Load()
+	if err == nil {
+		err = config.Validate()
+	}
+	var errs contacts.ConfigErrors
+	if err != nil && !errors.As(err, &errs) {
+		log.Fatal(err)
+	}
+	mail := contacts.SMTPConfig{
+		Host:     *smtpHost,
+		Port:     *smtpPort,
+		Username: *smtpUser,
+		Password: *smtpPass,
+	}
+	if mail.StartTLS, err = strconv.ParseBool(*startTLS); err != nil {
+		errs = append(errs, fmt.Sprintf("SMTP_STARTTLS (-smtp-starttls) must be true or false, not %q", *startTLS))
+	}
+	if mail.Host == "" {
+		errs = append(errs, "SMTP_HOST (-smtp-host) is required")
+	}
+	if len(specs) == 0 {
+		errs = append(errs, "at least one -reminder is required")
+	}
+	if *from == "" {
+		errs = append(errs, "REMINDER_FROM (-from) is required")
+	}
+	if errs != nil {
+		log.Fatal(errs)
+	}
+
+	text := contacts.DefaultDigestTemplate
+	if *templateFile != "" {
+		data, err := ioutil.ReadFile(*templateFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		text = string(data)
+	}
+	tmpl, err := contacts.ParseDigestTemplate(text)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *once {
+		send(config, mail, *from, specs, tmpl, time.Now())
+		return
+	}
+	for {
+		next, err := contacts.NextReminder(time.Now(), *at)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("next digest at %s", next.Format(time.RFC1123))
+		time.Sleep(time.Until(next))
+		send(config, mail, *from, specs, tmpl, next)
+	}
+}
+
+func send(config contacts.Config, mail contacts.SMTPConfig, from string, specs reminders, tmpl *template.Template, now time.Time) {
+	for _, reminder := range specs {
+		sent, err := contacts.SendReminder(config, mail, from, reminder, tmpl, now)
+		switch {
+		case err != nil:
+			log.Printf("reminder to %v: %v", reminder.To, err)
+		case sent:
+			log.Printf("sent reminder to %v", reminder.To)
+		}
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"jw4.us/contacts"
 )
@@ -13,38 +20,134 @@ import (
 const (
 	Port          = int64(8818)
 	ContactsRoute = "/contacts/"
+
+	ReadHeaderTimeout = 10 * time.Second
+	ReadTimeout       = time.Minute
+	WriteTimeout      = time.Minute
+	IdleTimeout       = 2 * time.Minute
+	ShutdownTimeout   = 30 * time.Second
+	DrainPeriod       = 10 * time.Second
 )
 
 func main() {
-	config := contacts.Config{
-		Host:     os.Getenv("LDAP_HOST"),
-		Port:     os.Getenv("LDAP_PORT"),
-		Username: os.Getenv("LDAP_USER"),
-		Password: os.Getenv("LDAP_PASS"),
-		BaseDN:   os.Getenv("LDAP_BASE"),
+	loader := contacts.NewConfigLoader(flag.CommandLine)
+	port := loader.String("PORT", "port", strconv.FormatInt(Port, 10), "port to serve on")
+	poll := loader.String("CHANGE_POLL_INTERVAL", "poll-interval", "", "how often to look for changes made outside the server, e.g. 1m")
+	templates := loader.String("TEMPLATE_FOLDER", "templates", "", "folder of templates overriding the built in ones")
+	public := loader.String("PUBLIC_FOLDER", "public", "", "folder of public files overriding the built in ones")
+	drain := loader.String("DRAIN_PERIOD", "drain-period", DrainPeriod.String(), "how long /readyz reports draining before the server stops accepting requests")
+	flag.Parse()
+
+	config, err := loader.Load()
+	if err == nil {
+		err = config.Validate()
+	}
+	var errs contacts.ConfigErrors
+	if err != nil && !errors.As(err, &errs) {
+		log.Fatal(err)
+	}
+	if _, err := strconv.ParseUint(*port, 10, 16); err != nil {
+		errs = append(errs, fmt.Sprintf("PORT (-port) must be a port number, not %q", *port))
+	}
+	var interval time.Duration
+	if *poll != "" {
+		if interval, err = time.ParseDuration(*poll); err != nil || interval <= 0 {
+			errs = append(errs, fmt.Sprintf("CHANGE_POLL_INTERVAL (-poll-interval) must be a duration like 1m, not %q", *poll))
+		}
+	}
+	drainPeriod, err := time.ParseDuration(*drain)
+	if err != nil || drainPeriod < 0 {
+		errs = append(errs, fmt.Sprintf("DRAIN_PERIOD (-drain-period) must be a duration like 10s, not %q", *drain))
+	}
+	templateFS, err := withOverrides(contacts.Templates, *templates)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("TEMPLATE_FOLDER (-templates): %v", err))
+	}
+	publicFS, err := withOverrides(contacts.Public, *public)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("PUBLIC_FOLDER (-public): %v", err))
+	}
+	if errs != nil {
+		log.Fatal(errs)
 	}
 
-	cs, err := contacts.NewWebServer(ContactsRoute, config, os.Getenv("TEMPLATE_FOLDER"))
+	stop := make(chan struct{})
+	if interval > 0 {
+		go contacts.WatchDirectory(config, interval, stop)
+	}
+
+	cs, err := contacts.NewWebServer(ContactsRoute, config, templateFS)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	health := &contacts.Health{Config: config, Templates: templateFS}
 	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.Live)
+	mux.HandleFunc("/readyz", health.Ready)
 	mux.Handle(ContactsRoute, cs)
-	mux.Handle("/", http.FileServer(http.Dir(os.Getenv("PUBLIC_FOLDER"))))
+	mux.Handle("/.well-known/carddav", http.RedirectHandler(ContactsRoute+"dav/", http.StatusMovedPermanently))
+	mux.Handle("/.well-known/caldav", http.RedirectHandler(ContactsRoute+"dav/", http.StatusMovedPermanently))
+	mux.Handle("/", http.FileServer(http.FS(publicFS)))
 
-	port := Port
-	if ports, ok := os.LookupEnv("PORT"); ok {
-		port, err = strconv.ParseInt(ports, 10, 16)
-		if err != nil {
-			log.Fatal(err)
-		}
+	s := &http.Server{
+		Addr:              ":" + *port,
+		Handler:           mux,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       ReadTimeout,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       IdleTimeout,
 	}
+	// Event streams would otherwise keep the server from shutting down.
+	s.RegisterOnShutdown(contacts.CloseChangeSubscriptions)
 
-	s := &http.Server{
-		Addr:    fmt.Sprintf(":%d", int16(port)),
-		Handler: mux,
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		log.Printf("%v: draining requests", <-signals)
+		// Keep serving until the readiness probes have seen the server
+		// draining and stopped sending it requests.
+		health.Drain()
+		time.Sleep(drainPeriod)
+		close(stop)
+
+		// Shutdown lets requests in flight, such as saves, finish.
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Printf("shutting down: %v", err)
+		}
+
+		// The webhook deliveries those requests started get long enough for
+		// every retry, so stopping can take DRAIN_PERIOD, ShutdownTimeout and
+		// contacts.WebhookDeliveryTimeout() in all; allow for that in the
+		// grace period given before the process is killed. Deliveries are not
+		// persisted, so any still pending after that are lost.
+		webhookCtx, cancelWebhooks := context.WithTimeout(context.Background(), contacts.WebhookDeliveryTimeout())
+		defer cancelWebhooks()
+		if err := contacts.WaitForWebhooks(webhookCtx); err != nil {
+			log.Printf("abandoning webhook deliveries: %v", err)
+		}
+	}()
+
+	if err := s.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
 	}
+	<-stopped
+}
 
-	log.Fatal(s.ListenAndServe())
+// withOverrides returns the built in files, overridden by those in folder
+// when it is set.
+func withOverrides(builtin fs.FS, folder string) (fs.FS, error) {
+	if folder == "" {
+		return builtin, nil
+	}
+	if info, err := os.Stat(folder); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", folder)
+	}
+	return contacts.Overlay(os.DirFS(folder), builtin), nil
 }
@@ -1,9 +1,385 @@
 package contacts
 
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
 type Config struct {
 	Host     string
 	Port     string
 	Username string
 	Password string
 	BaseDN   string
+
+	// DefaultRegion is the ISO country code used to interpret and format
+	// phone numbers of contacts that have no Country.
+	DefaultRegion string
+
+	// EditableAttributes lists unmapped directory attributes that may be
+	// edited through the web UI. All other unmapped attributes are shown
+	// read-only and never modified.
+	EditableAttributes []string
+
+	// Webhooks are notified after contacts are saved or deleted.
+	Webhooks []Webhook
+
+	// Auth configures who may sign in to the web server and what they may
+	// do there.
+	Auth AuthConfig
+}
+
+func (c Config) isEditable(name string) bool {
+	if isMappedAttribute(&Contact{}, name) {
+		return false
+	}
+	for _, editable := range c.EditableAttributes {
+		if strings.EqualFold(editable, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigErrors lists everything wrong with a configuration.
+type ConfigErrors []string
+
+func (e ConfigErrors) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+func (e ConfigErrors) add(format string, args ...interface{}) ConfigErrors {
+	return append(e, fmt.Sprintf(format, args...))
+}
+
+// Validate checks that the configuration can be used to reach the
+// directory. It returns nil, or ConfigErrors naming the settings to fix.
+func (c Config) Validate() error {
+	var errs ConfigErrors
+	if c.Host == "" {
+		errs = errs.add("%s is required", settingName("LDAP_HOST"))
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = errs.add("%s must be a port number, not %q", settingName("LDAP_PORT"), c.Port)
+	}
+	if c.Username != "" && c.Password == "" {
+		errs = errs.add("%s is required when %s is set", settingName("LDAP_PASS"), settingName("LDAP_USER"))
+	}
+	if c.BaseDN == "" {
+		errs = errs.add("%s is required", settingName("LDAP_BASE"))
+	} else if _, err := ldap.ParseDN(c.BaseDN); err != nil {
+		errs = errs.add("%s %q is not a DN: %v", settingName("LDAP_BASE"), c.BaseDN, err)
+	}
+	if c.DefaultRegion != "" {
+		if _, known := callingCodes[strings.ToUpper(c.DefaultRegion)]; !known {
+			errs = errs.add("%s %q is not a supported country code", settingName("DEFAULT_REGION"), c.DefaultRegion)
+		}
+	}
+	for _, hook := range c.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = errs.add("%s %q is not an http or https URL", settingName("WEBHOOK_URLS"), hook.URL)
+		}
+	}
+	if filter := c.Auth.UserFilter; filter != "" {
+		if strings.Count(filter, "%s") != 1 || strings.Count(filter, "%") != 1 {
+			errs = errs.add("%s %q must contain %%s once, where the user name goes", settingName("AUTH_USER_FILTER"), filter)
+		} else if _, err := ldap.CompileFilter(fmt.Sprintf(filter, "user")); err != nil {
+			errs = errs.add("%s %q is not an LDAP filter: %v", settingName("AUTH_USER_FILTER"), filter, err)
+		}
+	}
+	if base := c.Auth.UserBaseDN; base != "" {
+		if _, err := ldap.ParseDN(base); err != nil {
+			errs = errs.add("%s %q is not a DN: %v", settingName("AUTH_USER_BASE"), base, err)
+		}
+	}
+	for group, role := range c.Auth.Groups {
+		if _, err := ldap.ParseDN(group); err != nil {
+			errs = errs.add("%s %q is not a DN: %v", settingName("AUTH_"+strings.ToUpper(role.String())+"_GROUP"), group, err)
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// configSettings are the settings making up a Config, by the name used for
+// them in config files and the environment.
+var configSettings = []setting{
+	{key: "LDAP_HOST", flag: "ldap-host", usage: "LDAP server host name"},
+	{key: "LDAP_PORT", flag: "ldap-port", value: "389", usage: "LDAP server port"},
+	{key: "LDAP_USER", flag: "ldap-user", usage: "DN to bind to the LDAP server as"},
+	{key: "LDAP_PASS", flag: "ldap-pass", secret: true, usage: "password of the LDAP user"},
+	{key: "LDAP_BASE", flag: "ldap-base", usage: "base DN, with contacts kept below ou=contacts"},
+	{key: "DEFAULT_REGION", flag: "default-region", usage: "country code for the phone numbers and addresses of contacts without one"},
+	{key: "EDITABLE_ATTRIBUTES", flag: "editable-attributes", usage: "comma separated unmapped attributes that may be edited"},
+	{key: "WEBHOOK_URLS", flag: "webhook-urls", usage: "comma separated URLs notified of contact changes"},
+	{key: "WEBHOOK_SECRET", flag: "webhook-secret", secret: true, usage: "key signing webhook deliveries"},
+	{key: "AUTH_USER_FILTER", flag: "auth-user-filter", usage: "filter finding users signing in, e.g. (uid=%s); signing in is not required when empty"},
+	{key: "AUTH_USER_BASE", flag: "auth-user-base", usage: "base DN to search for users (default the LDAP base)"},
+	{key: "AUTH_DEFAULT_ROLE", flag: "auth-default-role", usage: "role of every signed in user: none, viewer, editor or admin"},
+	{key: "AUTH_VIEWER_GROUP", flag: "auth-viewer-group", usage: "DN of the group whose members are viewers"},
+	{key: "AUTH_EDITOR_GROUP", flag: "auth-editor-group", usage: "DN of the group whose members are editors"},
+	{key: "AUTH_ADMIN_GROUP", flag: "auth-admin-group", usage: "DN of the group whose members are admins"},
+	{key: "AUTH_VIEWERS", flag: "auth-viewers", usage: "comma separated user names of viewers"},
+	{key: "AUTH_EDITORS", flag: "auth-editors", usage: "comma separated user names of editors"},
+	{key: "AUTH_ADMINS", flag: "auth-admins", usage: "comma separated user names of admins"},
+}
+
+// settingName describes where the setting called key comes from, for
+// error messages.
+func settingName(key string) string {
+	for _, s := range configSettings {
+		if s.key == key {
+			return s.name()
+		}
+	}
+	return key
+}
+
+// setting is a single value read from a config file, the environment or a
+// flag. Secrets may instead be read from the file named by the setting
+// with _FILE appended to its key, and only that way from the command line
+// so that they do not show up in process listings.
+type setting struct {
+	key    string
+	flag   string
+	value  string
+	secret bool
+	usage  string
+
+	flagValue *string
+	target    *string
+}
+
+func (s setting) flagName() string {
+	if s.secret {
+		return s.flag + "-file"
+	}
+	return s.flag
+}
+
+func (s setting) name() string {
+	if s.secret {
+		return fmt.Sprintf("%s (%s_FILE, -%s)", s.key, s.key, s.flagName())
+	}
+	return fmt.Sprintf("%s (-%s)", s.key, s.flagName())
+}
+
+// resolve returns the value of the setting from the config file values, the
+// environment and the command line, each overriding the one before. Empty
+// values are treated as not set.
+func (s setting) resolve(file map[string]string, flagged map[string]bool) (string, error) {
+	value := s.value
+	for _, lookup := range []func(string) string{
+		func(key string) string { return file[key] },
+		os.Getenv,
+	} {
+		v, path := lookup(s.key), ""
+		if s.secret {
+			path = lookup(s.key + "_FILE")
+		}
+		switch {
+		case v != "" && path != "":
+			return "", fmt.Errorf("set only one of %s and %s_FILE", s.key, s.key)
+		case path != "":
+			secret, err := readSecret(path)
+			if err != nil {
+				return "", fmt.Errorf("%s_FILE: %v", s.key, err)
+			}
+			value = secret
+		case v != "":
+			value = v
+		}
+	}
+	if flagged[s.flagName()] {
+		if !s.secret {
+			return *s.flagValue, nil
+		}
+		secret, err := readSecret(*s.flagValue)
+		if err != nil {
+			return "", fmt.Errorf("-%s: %v", s.flagName(), err)
+		}
+		value = secret
+	}
+	return value, nil
+}
+
+// readSecret reads a secret kept alone in a file, such as a Docker secret.
+func readSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// ConfigLoader builds a Config, and any settings particular to a command,
+// from a config file, environment variables and command-line flags, in
+// increasing order of precedence.
+//
+// The config file is named by -config or $CONTACTS_CONFIG and holds
+// KEY=VALUE lines using the names of the environment variables. Blank
+// lines and lines starting with # are ignored.
+type ConfigLoader struct {
+	flags    *flag.FlagSet
+	file     *string
+	settings []*setting
+	config   map[string]*string
+}
+
+// NewConfigLoader registers the flags for the config file and the Config
+// settings on flags, which must be parsed before calling Load.
+func NewConfigLoader(flags *flag.FlagSet) *ConfigLoader {
+	l := &ConfigLoader{
+		flags:  flags,
+		file:   flags.String("config", "", "file of KEY=VALUE settings ($CONTACTS_CONFIG)"),
+		config: map[string]*string{},
+	}
+	for _, s := range configSettings {
+		l.config[s.key] = l.add(s)
+	}
+	return l
+}
+
+// String registers another setting, called key in config files and the
+// environment and flagName on the command line. The returned value is set
+// by Load.
+func (l *ConfigLoader) String(key, flagName, value, usage string) *string {
+	return l.add(setting{key: key, flag: flagName, value: value, usage: usage})
+}
+
+// Secret is like String for a setting that is read from a file when it is
+// given on the command line.
+func (l *ConfigLoader) Secret(key, flagName, usage string) *string {
+	return l.add(setting{key: key, flag: flagName, secret: true, usage: usage})
+}
+
+func (l *ConfigLoader) add(s setting) *string {
+	usage := fmt.Sprintf("%s ($%s)", s.usage, s.key)
+	if s.secret {
+		usage = fmt.Sprintf("file holding the %s ($%s or $%s_FILE)", s.usage, s.key, s.key)
+	}
+	s.flagValue = l.flags.String(s.flagName(), s.value, usage)
+	s.target = new(string)
+	*s.target = s.value
+	l.settings = append(l.settings, &s)
+	return s.target
+}
+
+// Load reads the settings. It reports settings that cannot be read or
+// parsed, but leaves checking that the Config is usable to Validate, as not
+// every command needs the directory.
+func (l *ConfigLoader) Load() (Config, error) {
+	flagged := map[string]bool{}
+	l.flags.Visit(func(f *flag.Flag) { flagged[f.Name] = true })
+
+	path := os.Getenv("CONTACTS_CONFIG")
+	if flagged["config"] {
+		path = *l.file
+	}
+	file := map[string]string{}
+	if path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs ConfigErrors
+	for _, s := range l.settings {
+		value, err := s.resolve(file, flagged)
+		if err != nil {
+			errs = errs.add("%v", err)
+		}
+		*s.target = value
+	}
+
+	get := func(key string) string { return *l.config[key] }
+	config := Config{
+		Host:               get("LDAP_HOST"),
+		Port:               get("LDAP_PORT"),
+		Username:           get("LDAP_USER"),
+		Password:           get("LDAP_PASS"),
+		BaseDN:             get("LDAP_BASE"),
+		DefaultRegion:      get("DEFAULT_REGION"),
+		EditableAttributes: splitList(get("EDITABLE_ATTRIBUTES")),
+		Auth: AuthConfig{
+			UserFilter: get("AUTH_USER_FILTER"),
+			UserBaseDN: get("AUTH_USER_BASE"),
+		},
+	}
+	for _, hook := range splitList(get("WEBHOOK_URLS")) {
+		config.Webhooks = append(config.Webhooks, Webhook{URL: hook, Secret: get("WEBHOOK_SECRET")})
+	}
+	if name := get("AUTH_DEFAULT_ROLE"); name != "" {
+		role, err := ParseRole(name)
+		if err != nil {
+			errs = errs.add("%s: %v", settingName("AUTH_DEFAULT_ROLE"), err)
+		}
+		config.Auth.DefaultRole = role
+	}
+	for _, role := range []Role{RoleViewer, RoleEditor, RoleAdmin} {
+		name := strings.ToUpper(role.String())
+		if group := get("AUTH_" + name + "_GROUP"); group != "" {
+			if config.Auth.Groups == nil {
+				config.Auth.Groups = map[string]Role{}
+			}
+			config.Auth.Groups[group] = role
+		}
+		for _, user := range splitList(get("AUTH_" + name + "S")) {
+			if config.Auth.Users == nil {
+				config.Auth.Users = map[string]Role{}
+			}
+			config.Auth.Users[user] = role
+		}
+	}
+	if errs != nil {
+		return config, errs
+	}
+	return config, nil
+}
+
+// readConfigFile reads the KEY=VALUE lines of a config file. Values may be
+// double quoted to keep surrounding spaces.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %v", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 1 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE, got %q", path, n, line)
+		}
+		key, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: bad quoting: %v", path, n, key, err)
+			}
+			value = unquoted
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading config file: %v", err)
+	}
+	return values, nil
 }
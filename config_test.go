@@ -0,0 +1,113 @@
+package contacts
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	file := write("contacts.conf", `# shared settings
+LDAP_HOST = file.example.org
+LDAP_PORT=1389
+LDAP_USER=cn=admin,dc=example,dc=org
+LDAP_PASS_FILE=`+write("ldap-pass", "from file\n")+`
+LDAP_BASE="dc=example,dc=org"
+AUTH_ADMINS=alice, bob
+EXTRA=file
+`)
+	for key, value := range map[string]string{"LDAP_PORT": "2389", "EXTRA": "env", "LDAP_HOST": ""} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewConfigLoader(flags)
+	extra := loader.String("EXTRA", "extra", "default", "an extra setting")
+	secret := loader.Secret("EXTRA_SECRET", "extra-secret", "an extra secret")
+	if err = flags.Parse([]string{"-config", file, "-ldap-port", "3389", "-extra-secret-file", write("secret", "s3cret")}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		Host:     "file.example.org",
+		Port:     "3389",
+		Username: "cn=admin,dc=example,dc=org",
+		Password: "from file",
+		BaseDN:   "dc=example,dc=org",
+		Auth:     AuthConfig{Users: map[string]Role{"alice": RoleAdmin, "bob": RoleAdmin}},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %+v, want %+v", config, want)
+	}
+	if *extra != "env" || *secret != "s3cret" {
+		t.Errorf("extra = %q, secret = %q", *extra, *secret)
+	}
+	if err = config.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	os.Setenv("LDAP_PASS", "both")
+	defer os.Unsetenv("LDAP_PASS")
+	os.Setenv("LDAP_PASS_FILE", filepath.Join(dir, "missing"))
+	defer os.Unsetenv("LDAP_PASS_FILE")
+	if _, err = loader.Load(); err == nil || !strings.Contains(err.Error(), "set only one of LDAP_PASS and LDAP_PASS_FILE") {
+		t.Errorf("Load = %v", err)
+	}
+
+	flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	loader = NewConfigLoader(flags)
+	if err = flags.Parse([]string{"-config", write("bad.conf", "LDAP_HOST\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loader.Load(); err == nil || !strings.Contains(err.Error(), "bad.conf:1: expected KEY=VALUE") {
+		t.Errorf("Load = %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	err := Config{
+		Port:          "",
+		Username:      "cn=admin",
+		BaseDN:        "not a dn",
+		DefaultRegion: "XX",
+		Webhooks:      []Webhook{{URL: "ftp://example.org"}},
+		Auth:          AuthConfig{UserFilter: "(uid=%d)"},
+	}.Validate()
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("Validate = %v", err)
+	}
+	for _, want := range []string{
+		"LDAP_HOST (-ldap-host) is required",
+		`LDAP_PORT (-ldap-port) must be a port number, not ""`,
+		"LDAP_PASS (LDAP_PASS_FILE, -ldap-pass-file) is required when LDAP_USER (-ldap-user) is set",
+		`LDAP_BASE (-ldap-base) "not a dn" is not a DN`,
+		`DEFAULT_REGION (-default-region) "XX" is not a supported country code`,
+		`WEBHOOK_URLS (-webhook-urls) "ftp://example.org" is not an http or https URL`,
+		`AUTH_USER_FILTER (-auth-user-filter) "(uid=%d)" must contain %s once`,
+	} {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("missing %q in %v", want, errs)
+		}
+	}
+}
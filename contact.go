@@ -1,9 +1,9 @@
 package contacts
 
 import (
+	"crypto/sha1"
 	"errors"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 	"time"
@@ -12,21 +12,29 @@ import (
 )
 
 type Contact struct {
-	ID         string
-	Name       string    `ldap:"displayName"`
-	First      string    `ldap:"givenName"`
-	Last       string    `ldap:"sn"`
-	Suffix     string    `ldap:"generationQualifier"`
-	Birthday   time.Time `ldap:"birthDate"`
-	Email      []string  `ldap:"mail"`
-	Phone      []string  `ldap:"telephoneNumber"`
-	Labels     []string  `ldap:"label"`
-	CommonName string    `ldap:"cn"`
-	Street     []string  `ldap:"street"`
-	City       string    `ldap:"l"`
-	State      string    `ldap:"st"`
-	Zip        string    `ldap:"postalCode"`
-	Country    string    `ldap:"countryCode"`
+	ID            string
+	Name          string    `ldap:"displayName"`
+	Prefix        string    `ldap:"personalTitle"`
+	First         string    `ldap:"givenName"`
+	Middle        string    `ldap:"middleName"`
+	Last          string    `ldap:"sn"`
+	Suffix        string    `ldap:"generationQualifier"`
+	Nickname      []string  `ldap:"nickname"`
+	PhoneticFirst string    `ldap:"phoneticGivenName"`
+	PhoneticLast  string    `ldap:"phoneticSurname"`
+	Birthday      time.Time `ldap:"birthDate"`
+	Email         []string  `ldap:"mail"`
+	Phone         []string  `ldap:"telephoneNumber"`
+	Labels        []string  `ldap:"label"`
+	CommonName    string    `ldap:"cn"`
+	Street        []string  `ldap:"street"`
+	City          string    `ldap:"l"`
+	State         string    `ldap:"st"`
+	Zip           string    `ldap:"postalCode"`
+	Country       string    `ldap:"countryCode"`
+
+	// Extra holds the unmapped attributes; changes() only touches those present.
+	Extra map[string][]string
 }
 
 func (c *Contact) Age() string { return c.AgeOn(time.Now()) }
@@ -58,16 +66,120 @@ func (c *Contact) DisplayName() string {
 	if c.CommonName != "" {
 		return c.CommonName
 	}
-	return strings.Join(
+	return joinNonEmpty(" ", c.First, c.Middle, c.Last, c.Suffix)
+}
+
+// FullName returns the complete name, including any honorific prefix.
+func (c *Contact) FullName() string {
+	if c == nil {
+		return ""
+	}
+	return c.StructuredName().String()
+}
+
+// StructuredName returns the parts of the contact's name.
+func (c *Contact) StructuredName() Name {
+	if c == nil {
+		return Name{}
+	}
+	return Name{Prefix: c.Prefix, First: c.First, Middle: c.Middle, Last: c.Last, Suffix: c.Suffix}
+}
+
+// SetName sets the parts of the contact's name.
+func (c *Contact) SetName(n Name) {
+	c.Prefix, c.First, c.Middle, c.Last, c.Suffix = n.Prefix, n.First, n.Middle, n.Last, n.Suffix
+}
+
+// PreferredNickname returns the first nickname, if any.
+func (c *Contact) PreferredNickname() string {
+	if c == nil || len(c.Nickname) == 0 {
+		return ""
+	}
+	return c.Nickname[0]
+}
+
+// PhoneticName returns the phonetic name, using the written parts it lacks.
+func (c *Contact) PhoneticName() string {
+	if c == nil {
+		return ""
+	}
+	if c.PhoneticFirst == "" && c.PhoneticLast == "" {
+		return c.DisplayName()
+	}
+	return strings.TrimSpace(strings.Join(
 		[]string{
-			strings.TrimSpace(c.First),
-			strings.TrimSpace(c.Last),
-		}, " ")
+			strings.TrimSpace(firstNonEmpty(c.PhoneticFirst, c.First)),
+			strings.TrimSpace(firstNonEmpty(c.PhoneticLast, c.Last)),
+		}, " "))
+}
+
+// Matches reports whether term appears in the contact's names or emails.
+func (c *Contact) Matches(term string) bool {
+	if c == nil {
+		return false
+	}
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return true
+	}
+	candidates := []string{
+		c.DisplayName(),
+		c.First,
+		c.Last,
+		c.PhoneticFirst,
+		c.PhoneticLast,
+	}
+	candidates = append(candidates, c.Nickname...)
+	candidates = append(candidates, c.Email...)
+	for _, candidate := range candidates {
+		if strings.Contains(strings.ToLower(candidate), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// UUID returns the version 5 UUID of the contact's DN.
+func (c *Contact) UUID() string {
+	if c == nil || c.ID == "" {
+		return ""
+	}
+	h := sha1.New()
+	h.Write(x500Namespace[:])
+	h.Write([]byte(c.ID))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// ExtraValues returns the values of the unmapped attribute name.
+func (c *Contact) ExtraValues(name string) []string {
+	if c == nil {
+		return nil
+	}
+	for k, v := range c.Extra {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
 }
 
 func (c *Contact) attributeNames() []string             { return attributeNames(c) }
 func (c *Contact) attributeValues() map[string][]string { return attributeValues(c) }
 
+// managedValues returns the mapped values plus the unmapped ones in managed.
+func (c *Contact) managedValues(managed map[string][]string) map[string][]string {
+	vals := c.attributeValues()
+	for k := range managed {
+		if v := c.ExtraValues(k); len(v) > 0 {
+			vals[k] = v
+		}
+	}
+	return vals
+}
+
 func (c *Contact) birthdayOrZero() time.Time {
 	if c == nil {
 		return time.Time{}
@@ -76,7 +188,20 @@ func (c *Contact) birthdayOrZero() time.Time {
 }
 
 func (c *Contact) changes(other *Contact) map[string]map[string][]string {
-	return changes(attributeValues(c), attributeValues(other))
+	var managed map[string][]string
+	if other != nil {
+		managed = other.Extra
+	}
+	return changes(c.managedValues(managed), other.managedValues(managed))
+}
+
+// ErrNotFound is returned when a requested contact does not exist.
+var ErrNotFound = errors.New("contact not found")
+
+// x500Namespace is the RFC 4122 namespace for UUIDs derived from DNs.
+var x500Namespace = [16]byte{
+	0x6b, 0xa7, 0xb8, 0x14, 0x9d, 0xad, 0x11, 0xd1,
+	0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8,
 }
 
 func List(config Config, labels []string) ([]*Contact, error) {
@@ -100,13 +225,16 @@ func Single(config Config, dn string) (*Contact, error) {
 	err := getEntries(config, request, func(e *ldap.Entry) {
 		contacts = append(contacts, fromEntry(e))
 	})
+	if hasResultCode(err, ldap.LDAPResultNoSuchObject) || hasResultCode(err, ldap.LDAPResultInvalidDNSyntax) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	switch len(contacts) {
 	case 0:
-		return nil, errors.New("err not found")
+		return nil, ErrNotFound
 	case 1:
 		return contacts[0], nil
 	default:
@@ -115,11 +243,31 @@ func Single(config Config, dn string) (*Contact, error) {
 	}
 }
 
+// SingleByUUID returns the contact whose UUID is id.
+func SingleByUUID(config Config, id string) (*Contact, error) {
+	records, err := List(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, contact := range records {
+		if contact.UUID() == id {
+			return contact, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
 func Delete(config Config, dn string) error {
+	deleted := &Contact{ID: dn}
+	if len(config.Webhooks) > 0 {
+		if contact, err := Single(config, dn); err == nil {
+			deleted = contact
+		}
+	}
 	if err := del(config, buildDeleteRequest(dn)); err != nil {
-		log.Printf("error deleting %q: %v", dn, err)
-		return errors.New("error deleting")
+		return fmt.Errorf("deleting contact: %w", err)
 	}
+	contactChanged(config, WebhookDelete, deleted, deleted.changes(&Contact{}))
 	return nil
 }
 
@@ -130,26 +278,45 @@ func Save(config Config, original, updated *Contact) error {
 	if original == nil {
 		original = &Contact{}
 	}
+	updated.Phone = normalizePhones(updated.Phone, updated.region(config.DefaultRegion))
+	if err := updated.Validate(); err != nil {
+		return err
+	}
 	// Update
 	if updated.ID != "" && original.ID == updated.ID {
+		changes := original.changes(updated)
 		if err := save(config, buildModifyRequest(original, updated)); err != nil {
-			log.Printf("error saving changes: %v", err)
-			return errors.New("error saving changes")
+			return fmt.Errorf("saving changes: %w", err)
 		}
+		contactChanged(config, WebhookUpdate, updated, changes)
 		return nil
 	}
 	// Create
 	if err := create(config, buildAddRequest(config.BaseDN, updated)); err != nil {
-		log.Printf("error creating contact: %v", err)
-		return errors.New("error creating contact")
+		return fmt.Errorf("creating contact: %w", err)
 	}
+	contactChanged(config, WebhookCreate, updated, (&Contact{}).changes(updated))
 	return nil
 }
 
+// Search filters contacts to those matching term.
+func Search(contacts []*Contact, term string) []*Contact {
+	if strings.TrimSpace(term) == "" {
+		return contacts
+	}
+	var found []*Contact
+	for _, contact := range contacts {
+		if contact.Matches(term) {
+			found = append(found, contact)
+		}
+	}
+	return found
+}
+
 func buildSearchRequest(baseDN string, labels []string) *ldap.SearchRequest {
 	var b strings.Builder
 	for _, label := range labels {
-		fmt.Fprintf(&b, "(label=%s)", label)
+		fmt.Fprintf(&b, "(label=%s)", ldap.EscapeFilter(label))
 	}
 	c := &Contact{}
 	return ldap.NewSearchRequest(
@@ -158,7 +325,7 @@ func buildSearchRequest(baseDN string, labels []string) *ldap.SearchRequest {
 		ldap.NeverDerefAliases,
 		0, 0, false,
 		fmt.Sprintf("(&(objectClass=contact)%s)", b.String()),
-		c.attributeNames(), nil)
+		append(c.attributeNames(), "*"), nil)
 }
 
 func buildModifyRequest(original, updated *Contact) *ldap.ModifyRequest {
@@ -186,7 +353,7 @@ func buildAddRequest(baseDN string, contact *Contact) *ldap.AddRequest {
 	if contact == nil {
 		return nil
 	}
-	contact.ID = fmt.Sprintf("cn=%s,ou=contacts,%s", contact.DisplayName(), baseDN)
+	contact.ID = newContactDN(baseDN, contact)
 	req := ldap.NewAddRequest(contact.ID, nil)
 	req.Attribute("objectClass", []string{
 		"contact",
@@ -195,12 +362,32 @@ func buildAddRequest(baseDN string, contact *Contact) *ldap.AddRequest {
 		"person",
 		"top",
 	})
-	for k, v := range contact.attributeValues() {
+	for k, v := range contact.managedValues(contact.Extra) {
 		req.Attribute(k, v)
 	}
 	return req
 }
 
+// newContactDN returns the DN a new contact is created with.
+func newContactDN(baseDN string, contact *Contact) string {
+	return fmt.Sprintf("cn=%s,ou=contacts,%s", escapeDNValue(contact.DisplayName()), baseDN)
+}
+
+// escapeDNValue escapes an attribute value for use in a DN (RFC 4514).
+func escapeDNValue(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func buildDeleteRequest(dn string) *ldap.DelRequest { return ldap.NewDelRequest(dn, nil) }
 
 func fromEntry(entry *ldap.Entry) *Contact {
@@ -210,5 +397,15 @@ func fromEntry(entry *ldap.Entry) *Contact {
 
 	c := &Contact{ID: entry.DN}
 	setAttributes(c, entry)
+	c.Extra = unmappedAttributes(c, entry)
 	return c
 }
+
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val != "" {
+			return val
+		}
+	}
+	return ""
+}
@@ -1,8 +1,11 @@
 package contacts
 
 import (
+	"net/url"
 	"testing"
 	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
 )
 
 func TestAttributeChanges(t *testing.T) {
@@ -44,3 +47,74 @@ func TestAttributeChanges(t *testing.T) {
 		t.Errorf("wrong number of modifies: %+v", ch["modify"])
 	}
 }
+
+func TestSearchNickname(t *testing.T) {
+	list := []*Contact{
+		{First: "Jonathan", Last: "Smith", Nickname: []string{"Jon"}},
+		{First: "Mary", Last: "Jones", Email: []string{"mary@example.org"}},
+	}
+	if found := Search(list, "jon"); len(found) != 2 {
+		t.Errorf("expected both contacts to match: %+v", found)
+	}
+	if found := Search(list, "JON "); len(found) != 2 {
+		t.Errorf("expected case insensitive match: %+v", found)
+	}
+	if found := Search(list, "example.org"); len(found) != 1 || found[0].First != "Mary" {
+		t.Errorf("expected email match: %+v", found)
+	}
+}
+
+func TestUnmanagedExtraUntouched(t *testing.T) {
+	original := &Contact{
+		ID:    "id",
+		First: "First",
+		Extra: map[string][]string{
+			"title":       {"Boss"},
+			"description": {"Old"},
+		},
+	}
+	updated := &Contact{
+		ID:    "id",
+		First: "First",
+		Extra: map[string][]string{"description": {"New"}},
+	}
+	ch := original.changes(updated)
+	if _, ok := ch["delete"]["title"]; ok {
+		t.Errorf("unmanaged attribute should not be deleted: %+v", ch)
+	}
+	if v := ch["modify"]["description"]; len(v) != 1 || v[0] != "New" {
+		t.Errorf("managed attribute should be modified: %+v", ch)
+	}
+
+	updated.Extra = map[string][]string{"description": {}}
+	ch = original.changes(updated)
+	if v := ch["delete"]["description"]; len(v) != 1 || v[0] != "Old" {
+		t.Errorf("cleared managed attribute should be deleted: %+v", ch)
+	}
+	if len(ch["delete"]) != 1 {
+		t.Errorf("only the managed attribute should be deleted: %+v", ch)
+	}
+}
+
+func TestSearchRequestEscapesLabels(t *testing.T) {
+	req := buildSearchRequest("dc=example", []string{"family", "*)(objectClass=*"})
+	want := `(&(objectClass=contact)(label=family)(label=\2a\29\28objectClass=\2a))`
+	if req.Filter != want {
+		t.Errorf("filter %s, want %s", req.Filter, want)
+	}
+}
+
+func TestAddRequestEscapesName(t *testing.T) {
+	contact := contactFromForm(url.Values{"displayName": {"van der Berg, Jane Q."}}, nil)
+	req := buildAddRequest("dc=example", contact)
+	dn, err := ldap.ParseDN(req.DN)
+	if err != nil {
+		t.Fatalf("%s: %v", req.DN, err)
+	}
+	if got := dn.RDNs[0].Attributes[0].Value; got != "van der Berg, Jane Q." {
+		t.Errorf("cn = %q", got)
+	}
+	if contact.ID != req.DN || contact.Last != "van der Berg" {
+		t.Errorf("contact %+v", contact)
+	}
+}
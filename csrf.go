@@ -0,0 +1,102 @@
+package contacts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	sessionCookie = "contacts_session"
+	csrfField     = "csrf"
+)
+
+type sessionKey struct{}
+
+// newSecret returns n random bytes, for keys that only need to last as long
+// as the process.
+func newSecret(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %v", err))
+	}
+	return b
+}
+
+// protect rejects requests that change things when they come from another
+// site, and gives every browser a session cookie that the CSRF tokens of
+// its forms are tied to.
+func (s *server) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "PROPFIND", "REPORT":
+		default:
+			if !sameOrigin(r) {
+				s.showError(w, r, &statusError{http.StatusForbidden,
+					fmt.Errorf("cross origin request from %q", r.Header.Get("Origin"))})
+				return
+			}
+		}
+
+		session := ""
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			session = cookie.Value
+		}
+		if len(session) < 32 {
+			session = base64.RawURLEncoding.EncodeToString(newSecret(32))
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    session,
+				Path:     s.baseRoute,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, session)))
+	})
+}
+
+// sameOrigin reports whether the browser making r says it comes from a page
+// on this server. Requests without Origin or Referer headers are not from
+// a browser, or from one that hides them; the CSRF token still protects
+// forms from those.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// csrfToken is the token the forms in pages served for r must carry.
+func (s *server) csrfToken(r *http.Request) string {
+	session, _ := r.Context().Value(sessionKey{}).(string)
+	if session == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.csrfKey)
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF returns an error reported as 403 Forbidden unless the posted
+// form carries the token of the session it was posted in.
+func (s *server) checkCSRF(r *http.Request) error {
+	want := s.csrfToken(r)
+	if want == "" || !hmac.Equal([]byte(r.PostForm.Get(csrfField)), []byte(want)) {
+		return &statusError{http.StatusForbidden, errors.New("missing or invalid CSRF token")}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package contacts
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	s := &server{baseRoute: "/contacts/", csrfKey: []byte("key"), tmpl: template.New("").Funcs(templateFuncs)}
+	if err := s.init(Templates); err != nil {
+		t.Fatal(err)
+	}
+	deleted := false
+	h := s.protect(s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			s.render(w, r, http.StatusOK, deleteTemplate, viewData{Contacts: []*Contact{{Name: "Jane"}}, Request: r})
+			return
+		}
+		r.ParseForm()
+		if err := s.checkCSRF(r); err != nil {
+			s.showError(w, r, err)
+			return
+		}
+		deleted = true
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/contacts/delete?dn=x", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].SameSite != http.SameSiteStrictMode || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	match := regexp.MustCompile(`name=csrf value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatalf("no csrf token in\n%s", rec.Body.String())
+	}
+
+	post := func(token, origin string, cookie *http.Cookie) int {
+		form := url.Values{"submit": {"Delete"}, "csrf": {token}}
+		r := httptest.NewRequest("POST", "http://example.com/contacts/delete?dn=x", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	other := &http.Cookie{Name: sessionCookie, Value: strings.Repeat("a", 43)}
+	for _, tc := range []struct {
+		name   string
+		token  string
+		origin string
+		cookie *http.Cookie
+	}{
+		{"no token", "", "", cookies[0]},
+		{"no session", match[1], "", nil},
+		{"other session", match[1], "", other},
+		{"other origin", match[1], "https://evil.example.org", cookies[0]},
+	} {
+		if code := post(tc.token, tc.origin, tc.cookie); code != http.StatusForbidden || deleted {
+			t.Errorf("%s: status = %d, deleted = %v", tc.name, code, deleted)
+		}
+	}
+	if code := post(match[1], "http://example.com", cookies[0]); code != http.StatusOK || !deleted {
+		t.Errorf("valid post: status = %d, deleted = %v", code, deleted)
+	}
+}
@@ -0,0 +1,410 @@
+package contacts
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CSVColumn maps a CSV column header to a Contact field. Field is one of
+// the names in csvFields.
+type CSVColumn struct {
+	Header string
+	Field  string
+}
+
+// CSVPreset describes the columns used by a particular CSV layout.
+type CSVPreset struct {
+	Name    string
+	Columns []CSVColumn
+	// Separator splits cells holding several values, e.g. two email
+	// addresses in one column.
+	Separator string
+}
+
+var (
+	csvFields = []string{
+		"name", "prefix", "first", "middle", "last", "suffix", "nickname",
+		"phoneticFirst", "phoneticLast", "email", "phone", "street", "city",
+		"state", "zip", "country", "birthday", "labels",
+	}
+
+	// csvRepeatedFields are the fields whose columns are numbered copies,
+	// such as "E-mail 2 Address", rather than alternative headers.
+	csvRepeatedFields = map[string]bool{"email": true, "phone": true}
+
+	// CSVPresets are the built in CSV layouts, by name.
+	CSVPresets = map[string]CSVPreset{
+		"native": {
+			Name:      "native",
+			Separator: " ::: ",
+			Columns: []CSVColumn{
+				{"Name", "name"}, {"Prefix", "prefix"}, {"First", "first"},
+				{"Middle", "middle"}, {"Last", "last"}, {"Suffix", "suffix"},
+				{"Nickname", "nickname"}, {"Phonetic First", "phoneticFirst"},
+				{"Phonetic Last", "phoneticLast"}, {"Email", "email"},
+				{"Phone", "phone"}, {"Street", "street"}, {"City", "city"},
+				{"State", "state"}, {"Zip", "zip"}, {"Country", "country"},
+				{"Birthday", "birthday"}, {"Labels", "labels"},
+			},
+		},
+		"google": {
+			Name:      "google",
+			Separator: " ::: ",
+			Columns: []CSVColumn{
+				{"Name", "name"}, {"Name Prefix", "prefix"}, {"Given Name", "first"},
+				{"First Name", "first"}, {"Additional Name", "middle"},
+				{"Middle Name", "middle"}, {"Family Name", "last"},
+				{"Last Name", "last"}, {"Name Suffix", "suffix"},
+				{"Nickname", "nickname"}, {"Given Name Yomi", "phoneticFirst"},
+				{"Phonetic First Name", "phoneticFirst"},
+				{"Family Name Yomi", "phoneticLast"},
+				{"Phonetic Last Name", "phoneticLast"}, {"Birthday", "birthday"},
+				{"Group Membership", "labels"}, {"Labels", "labels"},
+				{"E-mail 1 - Value", "email"}, {"E-mail 2 - Value", "email"},
+				{"E-mail 3 - Value", "email"}, {"Phone 1 - Value", "phone"},
+				{"Phone 2 - Value", "phone"}, {"Phone 3 - Value", "phone"},
+				{"Address 1 - Street", "street"}, {"Address 1 - City", "city"},
+				{"Address 1 - Region", "state"}, {"Address 1 - Postal Code", "zip"},
+				{"Address 1 - Country", "country"},
+			},
+		},
+		"outlook": {
+			Name:      "outlook",
+			Separator: ";",
+			Columns: []CSVColumn{
+				{"Title", "prefix"}, {"First Name", "first"}, {"Middle Name", "middle"},
+				{"Last Name", "last"}, {"Suffix", "suffix"}, {"Nickname", "nickname"},
+				{"E-mail Address", "email"}, {"E-mail 2 Address", "email"},
+				{"E-mail 3 Address", "email"}, {"Mobile Phone", "phone"},
+				{"Home Phone", "phone"}, {"Business Phone", "phone"},
+				{"Home Street", "street"}, {"Home City", "city"},
+				{"Home State", "state"}, {"Home Postal Code", "zip"},
+				{"Home Country/Region", "country"}, {"Birthday", "birthday"},
+				{"Categories", "labels"},
+			},
+		},
+	}
+)
+
+// CSVPresetNames lists the names of the built in presets.
+func CSVPresetNames() []string {
+	var names []string
+	for name := range CSVPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseCSVMapping parses column mappings written as "Header=field" pairs
+// separated by commas or new lines.
+func ParseCSVMapping(text string) ([]CSVColumn, error) {
+	var columns []CSVColumn
+	for _, pair := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		eq := strings.LastIndex(pair, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("mapping %q is not in the form Header=field", pair)
+		}
+		column := CSVColumn{Header: strings.TrimSpace(pair[:eq]), Field: strings.TrimSpace(pair[eq+1:])}
+		if !isCSVField(column.Field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", column.Field, strings.Join(csvFields, ", "))
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// ReadCSV reads contacts from r, which must start with a header row. The
+// named preset (or, when preset is empty, the preset that best matches the
+// header) is combined with mapping, which takes precedence.
+func ReadCSV(r io.Reader, preset string, mapping []CSVColumn) ([]*Contact, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %v", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+
+	var p CSVPreset
+	if preset == "" {
+		p = detectCSVPreset(header)
+	} else if known, ok := CSVPresets[preset]; ok {
+		p = known
+	} else {
+		return nil, fmt.Errorf("unknown csv preset %q", preset)
+	}
+
+	fields := make([]string, len(header))
+	for i, h := range header {
+		for _, column := range append(append([]CSVColumn(nil), mapping...), p.Columns...) {
+			if strings.EqualFold(strings.TrimSpace(h), column.Header) {
+				fields[i] = column.Field
+				break
+			}
+		}
+	}
+
+	var contacts []*Contact
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := &Contact{}
+		for i, value := range record {
+			if i < len(fields) && fields[i] != "" {
+				c.setCSVField(fields[i], splitCSVValue(value, p.Separator))
+			}
+		}
+		if c.First == "" && c.Last == "" && c.Name != "" {
+			c.SetName(ParseName(c.Name))
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, nil
+}
+
+// WriteCSV writes contacts to w using the columns of the named preset,
+// "native" when empty.
+func WriteCSV(w io.Writer, preset string, contacts ...*Contact) error {
+	if preset == "" {
+		preset = "native"
+	}
+	p, ok := CSVPresets[preset]
+	if !ok {
+		return fmt.Errorf("unknown csv preset %q", preset)
+	}
+
+	// Repeated fields are spread one value per column. Other fields are
+	// only written to their first column, which holds every value.
+	var columns []CSVColumn
+	counts := map[string]int{}
+	for _, column := range p.Columns {
+		if counts[column.Field] == 0 || csvRepeatedFields[column.Field] {
+			columns = append(columns, column)
+		}
+		counts[column.Field]++
+	}
+
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, c := range contacts {
+		if c == nil {
+			continue
+		}
+		record := make([]string, len(columns))
+		used := map[string]int{}
+		for i, column := range columns {
+			values := c.csvField(column.Field)
+			if csvRepeatedFields[column.Field] {
+				// The last column takes any values left over.
+				n := used[column.Field]
+				used[column.Field]++
+				switch {
+				case n >= len(values):
+					values = nil
+				case used[column.Field] < counts[column.Field]:
+					values = values[n : n+1]
+				default:
+					values = values[n:]
+				}
+			}
+			record[i] = strings.Join(values, p.Separator)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (c *Contact) setCSVField(field string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	set := func(dst *string) {
+		if *dst == "" {
+			*dst = strings.Join(values, " ")
+		}
+	}
+	switch field {
+	case "name":
+		set(&c.Name)
+	case "prefix":
+		set(&c.Prefix)
+	case "first":
+		set(&c.First)
+	case "middle":
+		set(&c.Middle)
+	case "last":
+		set(&c.Last)
+	case "suffix":
+		set(&c.Suffix)
+	case "phoneticFirst":
+		set(&c.PhoneticFirst)
+	case "phoneticLast":
+		set(&c.PhoneticLast)
+	case "city":
+		set(&c.City)
+	case "state":
+		set(&c.State)
+	case "zip":
+		set(&c.Zip)
+	case "country":
+		if c.Country == "" {
+			c.Country = countryFromName(values[0])
+		}
+	case "nickname":
+		c.Nickname = dedupe(append(c.Nickname, values...))
+	case "email":
+		c.Email = dedupe(append(c.Email, values...))
+	case "phone":
+		c.Phone = dedupe(append(c.Phone, values...))
+	case "street":
+		for _, value := range values {
+			c.Street = append(c.Street, strings.Split(value, "\n")...)
+		}
+		c.Street = dedupe(c.Street)
+	case "labels":
+		for _, value := range values {
+			// Google marks system groups such as "* myContacts" with a star.
+			if !strings.HasPrefix(value, "* ") {
+				c.Labels = append(c.Labels, value)
+			}
+		}
+		c.Labels = dedupe(c.Labels)
+	case "birthday":
+		if c.Birthday.IsZero() {
+			c.Birthday = parseCSVDate(values[0])
+		}
+	}
+}
+
+func (c *Contact) csvField(field string) []string {
+	one := func(value string) []string {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	switch field {
+	case "name":
+		return one(c.DisplayName())
+	case "prefix":
+		return one(c.Prefix)
+	case "first":
+		return one(c.First)
+	case "middle":
+		return one(c.Middle)
+	case "last":
+		return one(c.Last)
+	case "suffix":
+		return one(c.Suffix)
+	case "phoneticFirst":
+		return one(c.PhoneticFirst)
+	case "phoneticLast":
+		return one(c.PhoneticLast)
+	case "city":
+		return one(c.City)
+	case "state":
+		return one(c.State)
+	case "zip":
+		return one(c.Zip)
+	case "country":
+		return one(countryName(countryCode(c.Country)))
+	case "nickname":
+		return c.Nickname
+	case "email":
+		return c.Email
+	case "phone":
+		return c.Phone
+	case "street":
+		return one(strings.Join(c.Street, "\n"))
+	case "labels":
+		return c.Labels
+	case "birthday":
+		switch {
+		case c.Birthday.IsZero():
+			return nil
+		case c.Birthday.Year() == 0:
+			return one(c.Birthday.Format("--01-02"))
+		default:
+			return one(c.Birthday.Format("2006-01-02"))
+		}
+	}
+	return nil
+}
+
+// detectCSVPreset picks the preset whose headers best match header.
+func detectCSVPreset(header []string) CSVPreset {
+	best, bestScore := CSVPresets["native"], 0
+	for _, name := range CSVPresetNames() {
+		p, score := CSVPresets[name], 0
+		for _, h := range header {
+			for _, column := range p.Columns {
+				if strings.EqualFold(strings.TrimSpace(h), column.Header) {
+					score++
+					break
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+func parseCSVDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "0/0/") {
+		return time.Time{}
+	}
+	if date := parseVCardDate(value); !date.IsZero() {
+		return date
+	}
+	return parseDate(value)
+}
+
+func splitCSVValue(value, separator string) []string {
+	var values []string
+	parts := []string{value}
+	if separator != "" {
+		parts = strings.Split(value, separator)
+	}
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func isCSVField(field string) bool {
+	for _, known := range csvFields {
+		if known == field {
+			return true
+		}
+	}
+	return false
+}
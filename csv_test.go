@@ -0,0 +1,112 @@
+package contacts
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSVGoogle(t *testing.T) {
+	data := "Name,Given Name,Family Name,Birthday,Group Membership,E-mail 1 - Value,Phone 1 - Value,Address 1 - City,Address 1 - Country\n" +
+		"Jane Doe,Jane,Doe,--02-03,* myContacts ::: Family,jane@example.org ::: jd@example.org,555-123-4567,Springfield,United States\n"
+	contacts, err := ReadCSV(strings.NewReader(data), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 1 {
+		t.Fatalf("expected one contact, got %d", len(contacts))
+	}
+	c := contacts[0]
+	if c.First != "Jane" || c.Last != "Doe" || c.Country != "US" || c.City != "Springfield" {
+		t.Errorf("unexpected contact: %+v", c)
+	}
+	if len(c.Email) != 2 {
+		t.Errorf("expected multi-value split: %q", c.Email)
+	}
+	if len(c.Labels) != 1 || c.Labels[0] != "Family" {
+		t.Errorf("expected system groups to be dropped: %q", c.Labels)
+	}
+	if c.Birthday.Month() != time.February || c.Birthday.Day() != 3 || c.Birthday.Year() != 0 {
+		t.Errorf("unexpected birthday: %v", c.Birthday)
+	}
+}
+
+func TestReadCSVOutlookWithMapping(t *testing.T) {
+	data := "First Name,Last Name,E-mail Address,Mobile Phone,Birthday,Categories,Spouse\n" +
+		"John,Roe,john@example.org,555-987-6543,3/4/1970,Family;Work,Jill\n"
+	mapping, err := ParseCSVMapping("Spouse=nickname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts, err := ReadCSV(strings.NewReader(data), "outlook", mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := contacts[0]
+	if c.Birthday.Year() != 1970 || c.Birthday.Month() != time.March {
+		t.Errorf("unexpected birthday: %v", c.Birthday)
+	}
+	if len(c.Labels) != 2 || len(c.Nickname) != 1 {
+		t.Errorf("unexpected labels or mapped nickname: %+v", c)
+	}
+	if _, err := ParseCSVMapping("Spouse=spouse"); err == nil {
+		t.Errorf("expected unknown field to be rejected")
+	}
+}
+
+func TestWriteCSVRoundTrip(t *testing.T) {
+	c := &Contact{
+		First:    "Jane",
+		Last:     "Doe",
+		Email:    []string{"jane@example.org", "jd@example.org"},
+		Street:   []string{"1 Main St"},
+		Birthday: time.Date(1980, time.February, 3, 0, 0, 0, 0, time.UTC),
+	}
+	for _, preset := range CSVPresetNames() {
+		var b bytes.Buffer
+		if err := WriteCSV(&b, preset, c); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadCSV(&b, preset, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) != 1 || read[0].Last != "Doe" || len(read[0].Email) != 2 || read[0].BirthYear() != 1980 {
+			t.Errorf("%s: round trip mismatch: %+v", preset, read)
+		}
+	}
+}
+
+func TestWriteCSVRepeatedColumns(t *testing.T) {
+	c := &Contact{
+		First: "Jane",
+		Email: []string{"a@example.org", "b@example.org", "c@example.org", "d@example.org"},
+		Phone: []string{"555-0100", "555-0101"},
+	}
+	var b bytes.Buffer
+	if err := WriteCSV(&b, "outlook", c); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := map[string]string{}
+	for i, header := range records[0] {
+		row[header] = records[1][i]
+	}
+	for header, want := range map[string]string{
+		"E-mail Address":   "a@example.org",
+		"E-mail 2 Address": "b@example.org",
+		"E-mail 3 Address": "c@example.org;d@example.org",
+		"Mobile Phone":     "555-0100",
+		"Home Phone":       "555-0101",
+		"Business Phone":   "",
+	} {
+		if row[header] != want {
+			t.Errorf("%s = %q, want %q", header, row[header], want)
+		}
+	}
+}
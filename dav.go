@@ -0,0 +1,565 @@
+package contacts
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	davRoute = "dav/"
+
+	nsDAV            = "DAV:"
+	nsCardDAV        = "urn:ietf:params:xml:ns:carddav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+
+	// davPrincipal is the path of the single principal all collections
+	// belong to.
+	davPrincipal = "principal/"
+
+	// maxSyncTokens is the number of collection states remembered for
+	// sync-collection reports.
+	maxSyncTokens = 256
+)
+
+// davPrefixes are the namespace prefixes used in responses.
+var davPrefixes = map[string]string{
+	nsDAV:            "d",
+	nsCardDAV:        "card",
+	nsCalendarServer: "cs",
+}
+
+func davName(space, local string) xml.Name { return xml.Name{Space: space, Local: local} }
+
+// davResource is a node of the WebDAV tree. Its path is relative to the
+// dav route, escaped, and ends in a slash for collections.
+type davResource struct {
+	path     string
+	props    map[xml.Name]string
+	children []*davResource
+
+	// Set for non-collection resources.
+	body        string
+	contentType string
+	etag        string
+	contact     *Contact
+
+	// The address book of a collection or of a contact in one.
+	book *addressBook
+}
+
+func (r *davResource) isCollection() bool { return strings.HasSuffix(r.path, "/") || r.path == "" }
+
+// setContent sets the body of a non-collection resource along with the
+// properties derived from it.
+func (r *davResource) setContent(body, contentType string) {
+	r.body, r.contentType = body, contentType
+	r.etag = fmt.Sprintf(`"%x"`, sha1.Sum([]byte(body)))
+	r.props[davName(nsDAV, "getetag")] = davEscape(r.etag)
+	r.props[davName(nsDAV, "getcontenttype")] = davEscape(contentType)
+	r.props[davName(nsDAV, "getcontentlength")] = fmt.Sprint(len(body))
+	r.props[davName(nsDAV, "resourcetype")] = ""
+}
+
+// davTree is every resource of the WebDAV tree by path.
+type davTree map[string]*davResource
+
+func (t davTree) add(parent *davResource, r *davResource) *davResource {
+	t[r.path] = r
+	if parent != nil {
+		parent.children = append(parent.children, r)
+	}
+	return r
+}
+
+// readOnly only grants read privileges on every resource, for users who
+// may not edit contacts.
+func (t davTree) readOnly() {
+	for _, r := range t {
+		r.props[davName(nsDAV, "current-user-privilege-set")] = "<d:privilege><d:read/></d:privilege>"
+	}
+}
+
+// davState remembers the member ETags of collections by sync token so that
+// sync-collection reports can list what changed since a token was issued,
+// and the names clients gave the contacts they created.
+type davState struct {
+	mu     sync.Mutex
+	tokens map[string]map[string]string
+	order  []string
+	names  map[string]string
+}
+
+// syncToken returns the token of a collection whose members have the given
+// ETags by path, remembering them for later reports.
+func (d *davState) syncToken(members map[string]string) string {
+	paths := make([]string, 0, len(members))
+	for p := range members {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	h := sha1.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s %s\n", p, members[p])
+	}
+	token := fmt.Sprintf("data:,%x", h.Sum(nil))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tokens == nil {
+		d.tokens = map[string]map[string]string{}
+	}
+	if _, ok := d.tokens[token]; !ok {
+		d.tokens[token] = members
+		d.order = append(d.order, token)
+		if len(d.order) > maxSyncTokens {
+			delete(d.tokens, d.order[0])
+			d.order = d.order[1:]
+		}
+	}
+	return token
+}
+
+func (d *davState) members(token string) (map[string]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	members, ok := d.tokens[token]
+	return members, ok
+}
+
+// name returns the resource name a client created the contact dn with.
+func (d *davState) name(dn string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name, ok := d.names[dn]
+	return name, ok
+}
+
+func (d *davState) setName(dn, name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.names == nil {
+		d.names = map[string]string{}
+	}
+	d.names[dn] = name
+}
+
+// davNode is a generic element of a WebDAV request body.
+type davNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []davNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (n davNode) child(space, local string) (davNode, bool) {
+	for _, c := range n.Children {
+		if c.XMLName.Space == space && c.XMLName.Local == local {
+			return c, true
+		}
+	}
+	return davNode{}, false
+}
+
+func (n davNode) all(space, local string) []davNode {
+	var found []davNode
+	for _, c := range n.Children {
+		if c.XMLName.Space == space && c.XMLName.Local == local {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+func (n davNode) attr(name, def string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return def
+}
+
+// handleDAV serves the CardDAV and CalDAV tree:
+//
+//	dav/                                          root, points at the principal
+//	dav/principal/                                the principal
+//	dav/addressbooks/                             addressbook home
+//	dav/addressbooks/all/                         every contact
+//	dav/addressbooks/label-{label}/               contacts with a label
+//	dav/addressbooks/{book}/{id}.vcf              a contact
+//	dav/calendars/                                calendar home
+//	dav/calendars/birthdays/                      read-only birthday calendar
+//	dav/calendars/birthdays/{id}-birthday.ics     a birthday
+func (s *server) handleDAV(w http.ResponseWriter, r *http.Request) {
+	tree, err := s.davTree(!userFrom(r).CanEdit())
+	if err != nil {
+		log.Printf("dav: %v", err)
+		http.Error(w, "Directory Unavailable", http.StatusBadGateway)
+		return
+	}
+	p := s.davPath(r.URL.EscapedPath())
+	res := tree[p]
+	if res == nil && !strings.HasSuffix(p, "/") {
+		res = tree[p+"/"]
+	}
+
+	w.Header().Set("DAV", "1, 3, addressbook, calendar-access")
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+		return
+	case "PUT":
+		if allowed(r, RoleEditor) != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		s.davPut(w, r, tree, p)
+		return
+	}
+	if res == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+		s.davGet(w, r, res)
+	case "PROPFIND":
+		s.davPropfind(w, r, res)
+	case "REPORT":
+		s.davReport(w, r, tree, res)
+	case "DELETE":
+		s.davDelete(w, r, res)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) buildDAVTree(records []*Contact) davTree {
+	tree := davTree{}
+	root := tree.add(nil, s.davCollection("", "Contacts"))
+	principal := tree.add(root, s.davCollection(davPrincipal, "Contacts"))
+	principal.props[davName(nsDAV, "resourcetype")] = "<d:principal/>"
+	s.addAddressBooks(tree, root, principal, records)
+	s.addCalendars(tree, root, principal, records, time.Now())
+	return tree
+}
+
+// davCollection returns a collection with the properties every resource in
+// the tree shares.
+func (s *server) davCollection(p, name string) *davResource {
+	return &davResource{path: p, props: map[xml.Name]string{
+		davName(nsDAV, "resourcetype"):           "<d:collection/>",
+		davName(nsDAV, "displayname"):            davEscape(name),
+		davName(nsDAV, "current-user-principal"): s.davHref(davPrincipal),
+		davName(nsDAV, "principal-URL"):          s.davHref(davPrincipal),
+		davName(nsDAV, "owner"):                  s.davHref(davPrincipal),
+		davName(nsDAV, "current-user-privilege-set"): "<d:privilege><d:read/></d:privilege>" +
+			"<d:privilege><d:write/></d:privilege>",
+	}}
+}
+
+// davMember returns a non-collection resource below parent.
+func (s *server) davMember(parent *davResource, name string) *davResource {
+	r := s.davCollection(parent.path+url.PathEscape(name), "")
+	delete(r.props, davName(nsDAV, "displayname"))
+	return r
+}
+
+// davSync sets the sync token of a collection from its members.
+func (s *server) davSync(collection *davResource) {
+	members := map[string]string{}
+	for _, child := range collection.children {
+		members[child.path] = child.etag
+	}
+	token := s.dav.syncToken(members)
+	collection.props[davName(nsDAV, "sync-token")] = davEscape(token)
+	collection.props[davName(nsCalendarServer, "getctag")] = davEscape(token)
+}
+
+func (s *server) davGet(w http.ResponseWriter, r *http.Request, res *davResource) {
+	if res.isCollection() {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", res.contentType)
+	w.Header().Set("ETag", res.etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && match == res.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+	if _, err := io.WriteString(w, res.body); err != nil {
+		log.Printf("dav get %q: %v", res.path, err)
+	}
+}
+
+func (s *server) davPropfind(w http.ResponseWriter, r *http.Request, res *davResource) {
+	body, ok := readDAVBody(w, r)
+	if !ok {
+		return
+	}
+	if body.XMLName.Local == "" {
+		body = davNode{XMLName: davName(nsDAV, "propfind"), Children: []davNode{{XMLName: davName(nsDAV, "allprop")}}}
+	}
+	if body.XMLName != davName(nsDAV, "propfind") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	resources := []*davResource{res}
+	if r.Header.Get("Depth") != "0" {
+		resources = append(resources, res.children...)
+	}
+	var responses []string
+	for _, each := range resources {
+		responses = append(responses, s.davPropResponse(each, body))
+	}
+	writeMultistatus(w, responses, "")
+}
+
+// davPropResponse answers the prop, allprop or propname request in body for
+// res.
+func (s *server) davPropResponse(res *davResource, body davNode) string {
+	if _, ok := body.child(nsDAV, "propname"); ok {
+		names := make(map[xml.Name]string, len(res.props))
+		for name := range res.props {
+			names[name] = ""
+		}
+		return davResponse(s.davHref(res.path), names, nil)
+	}
+	if prop, ok := body.child(nsDAV, "prop"); ok {
+		found := map[xml.Name]string{}
+		var missing []xml.Name
+		for _, want := range prop.Children {
+			value, ok := res.props[want.XMLName]
+			switch {
+			case want.XMLName == davName(nsCardDAV, "address-data") && res.book != nil && res.contact != nil:
+				value, ok = davEscape(res.contact.VCard(want.attr("version", VCard3), s.config.DefaultRegion)), true
+			case want.XMLName == davName(nsCalDAV, "calendar-data") && strings.HasPrefix(res.contentType, "text/calendar"):
+				value, ok = davEscape(res.body), true
+			}
+			if ok {
+				found[want.XMLName] = value
+			} else {
+				missing = append(missing, want.XMLName)
+			}
+		}
+		return davResponse(s.davHref(res.path), found, missing)
+	}
+	found := map[xml.Name]string{}
+	for name, value := range res.props {
+		found[name] = value
+	}
+	return davResponse(s.davHref(res.path), found, nil)
+}
+
+// davPath returns the escaped path below the dav route of an escaped
+// request path, with every segment escaped the same way as the tree.
+func (s *server) davPath(p string) string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(p, s.davRoute()), "/")
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = url.PathEscape(unescaped)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// davHrefPath returns the tree path of an href from a request body, which
+// may be an absolute URL.
+func (s *server) davHrefPath(href string) string {
+	if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+		href = u.EscapedPath()
+	}
+	return s.davPath(href)
+}
+
+func (s *server) davHref(p string) string {
+	return "<d:href>" + davEscape(s.davRoute()+"/"+p) + "</d:href>"
+}
+
+func (s *server) davRoute() string { return path.Join(s.baseRoute, davRoute) }
+
+// readDAVBody parses the XML body of r, which may be empty.
+func readDAVBody(w http.ResponseWriter, r *http.Request) (davNode, bool) {
+	var body davNode
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err == nil && len(bytes.TrimSpace(data)) > 0 {
+		err = xml.Unmarshal(data, &body)
+	}
+	if err != nil {
+		log.Printf("dav %s %q: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return davNode{}, false
+	}
+	return body, true
+}
+
+// davResponse returns a response element with the found properties and
+// the missing ones.
+func davResponse(href string, found map[xml.Name]string, missing []xml.Name) string {
+	var b strings.Builder
+	b.WriteString("<d:response>" + href)
+	if len(found) > 0 {
+		names := make([]xml.Name, 0, len(found))
+		for name := range found {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return names[i].Space+" "+names[i].Local < names[j].Space+" "+names[j].Local
+		})
+		b.WriteString("<d:propstat><d:prop>")
+		for _, name := range names {
+			b.WriteString(davElement(name, found[name]))
+		}
+		b.WriteString("</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+	}
+	if len(missing) > 0 {
+		b.WriteString("<d:propstat><d:prop>")
+		for _, name := range missing {
+			b.WriteString(davElement(name, ""))
+		}
+		b.WriteString("</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+	}
+	b.WriteString("</d:response>")
+	return b.String()
+}
+
+// davStatus returns a response element with only a status.
+func davStatus(href string, status int) string {
+	return fmt.Sprintf("<d:response>%s<d:status>HTTP/1.1 %d %s</d:status></d:response>",
+		href, status, http.StatusText(status))
+}
+
+// davElement returns the element name with the XML content inner.
+func davElement(name xml.Name, inner string) string {
+	tag, decl := name.Local, ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		decl = fmt.Sprintf(` xmlns="%s"`, davEscape(name.Space))
+	}
+	if inner == "" {
+		return "<" + tag + decl + "/>"
+	}
+	return "<" + tag + decl + ">" + inner + "</" + tag + ">"
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []string, extra string) {
+	writeDAVXML(w, http.StatusMultiStatus, davElement(davName(nsDAV, "multistatus"), strings.Join(responses, "")+extra))
+}
+
+// writeDAVError writes a DAV:error body naming the failed precondition.
+func writeDAVError(w http.ResponseWriter, status int, condition xml.Name) {
+	writeDAVXML(w, status, davElement(davName(nsDAV, "error"), davElement(condition, "")))
+}
+
+func writeDAVXML(w http.ResponseWriter, status int, body string) {
+	var ns []string
+	for space, prefix := range davPrefixes {
+		ns = append(ns, fmt.Sprintf(` xmlns:%s="%s"`, prefix, space))
+	}
+	sort.Strings(ns)
+	if end := strings.IndexAny(body, " />"); end > 0 {
+		body = body[:end] + strings.Join(ns, "") + body[end:]
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := io.WriteString(w, xml.Header+body); err != nil {
+		log.Printf("writing dav response: %v", err)
+	}
+}
+
+func davEscape(s string) string {
+	var b bytes.Buffer
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// davReport answers REPORT requests on collections.
+func (s *server) davReport(w http.ResponseWriter, r *http.Request, tree davTree, res *davResource) {
+	body, ok := readDAVBody(w, r)
+	if !ok {
+		return
+	}
+	switch body.XMLName {
+	case davName(nsDAV, "sync-collection"):
+		s.davSyncCollection(w, res, body)
+	case davName(nsCardDAV, "addressbook-multiget"), davName(nsCalDAV, "calendar-multiget"):
+		s.davMultiget(w, tree, body)
+	case davName(nsCardDAV, "addressbook-query"):
+		s.addressBookQuery(w, r, res, body)
+	case davName(nsCalDAV, "calendar-query"):
+		s.calendarQuery(w, r, res, body)
+	default:
+		writeDAVError(w, http.StatusForbidden, davName(nsDAV, "supported-report"))
+	}
+}
+
+// davMultiget answers the properties asked for in body of every resource
+// listed in its hrefs.
+func (s *server) davMultiget(w http.ResponseWriter, tree davTree, body davNode) {
+	var responses []string
+	for _, href := range body.all(nsDAV, "href") {
+		p := s.davHrefPath(href.Text)
+		if member := tree[p]; member != nil {
+			responses = append(responses, s.davPropResponse(member, body))
+		} else {
+			responses = append(responses, davStatus(s.davHref(p), http.StatusNotFound))
+		}
+	}
+	writeMultistatus(w, responses, "")
+}
+
+// davSyncCollection answers a sync-collection report with the members that
+// changed since the token in body, or every member without a token.
+func (s *server) davSyncCollection(w http.ResponseWriter, res *davResource, body davNode) {
+	if _, ok := res.props[davName(nsDAV, "sync-token")]; !ok {
+		writeDAVError(w, http.StatusForbidden, davName(nsDAV, "supported-report"))
+		return
+	}
+	var previous map[string]string
+	if token, _ := body.child(nsDAV, "sync-token"); strings.TrimSpace(token.Text) != "" {
+		var ok bool
+		if previous, ok = s.dav.members(strings.TrimSpace(token.Text)); !ok {
+			writeDAVError(w, http.StatusForbidden, davName(nsDAV, "valid-sync-token"))
+			return
+		}
+	}
+	var responses []string
+	current := map[string]bool{}
+	for _, member := range res.children {
+		current[member.path] = true
+		if etag, ok := previous[member.path]; !ok || etag != member.etag {
+			responses = append(responses, s.davPropResponse(member, body))
+		}
+	}
+	var removed []string
+	for p := range previous {
+		if !current[p] {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(removed)
+	for _, p := range removed {
+		responses = append(responses, davStatus(s.davHref(p), http.StatusNotFound))
+	}
+	writeMultistatus(w, responses, davElement(davName(nsDAV, "sync-token"), res.props[davName(nsDAV, "sync-token")]))
+}
@@ -0,0 +1,84 @@
+package contacts
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+var (
+	//go:embed templates/*.html
+	embeddedTemplates embed.FS
+
+	//go:embed public
+	embeddedPublic embed.FS
+
+	// Templates are the page templates built into the binary, used by
+	// NewWebServer when it is not given any.
+	Templates = subFS(embeddedTemplates, "templates")
+
+	// Public holds the stylesheets, scripts and images the pages link to,
+	// to be served from the root of the site.
+	Public = subFS(embeddedPublic, "public")
+)
+
+func subFS(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Overlay returns a file system with the files of all the layers, where
+// files in earlier layers hide those with the same name in later ones. It
+// lets a folder of customized templates or stylesheets override just the
+// files it has.
+func Overlay(layers ...fs.FS) fs.FS { return overlayFS(layers) }
+
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir merges the entries of name in every layer so that globbing sees
+// the files of them all.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var (
+		entries []fs.DirEntry
+		found   bool
+		seen    = map[string]bool{}
+	)
+	for _, layer := range o {
+		list, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, entry := range list {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
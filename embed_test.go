@@ -0,0 +1,48 @@
+package contacts
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbedded(t *testing.T) {
+	for _, name := range []string{"main.js", "styles.css", "vendor/underscore-min.js"} {
+		if _, err := fs.Stat(Public, name); err != nil {
+			t.Errorf("public %s: %v", name, err)
+		}
+	}
+	header, err := fs.ReadFile(Templates, "header.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(header), "https://") {
+		t.Errorf("header loads remote resources:\n%s", header)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	custom := fstest.MapFS{
+		"list.html":  {Data: []byte(`{{ template "header" $ }}custom list{{ template "footer" $ }}`)},
+		"extra.html": {Data: []byte(`{{ define "extra" }}extra{{ end }}`)},
+	}
+	templates := Overlay(custom, Templates)
+	names, err := fs.Glob(templates, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined := strings.Join(names, " "); !strings.Contains(joined, "extra.html") || !strings.Contains(joined, "detail.html") || strings.Count(joined, "list.html") != 1 {
+		t.Errorf("glob = %v", names)
+	}
+	list, err := fs.ReadFile(templates, "list.html")
+	if err != nil || !strings.Contains(string(list), "custom list") {
+		t.Errorf("list.html = %q, %v", list, err)
+	}
+	if _, err = fs.ReadFile(templates, "missing.html"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if _, err = NewWebServer("/contacts/", Config{}, templates); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package contacts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+const errorTemplate = "error.html"
+
+// statusError is an error reported with a particular HTTP status.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+var errPageNotFound = &statusError{http.StatusNotFound, errors.New("page not found")}
+
+// errorStatus returns the HTTP status used to report err: 404 for unknown
+// contacts, 503 when the directory cannot be reached, 502 when it fails an
+// operation and 500 for anything else.
+func errorStatus(err error) int {
+	var (
+		status    *statusError
+		directory *DirectoryError
+		netErr    net.Error
+	)
+	switch {
+	case errors.As(err, &status):
+		return status.status
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &directory) && directory.Unavailable():
+		return http.StatusServiceUnavailable
+	case errors.As(err, &directory):
+		return http.StatusBadGateway
+	case errors.As(err, &netErr):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorMessage explains status to the person seeing the error page without
+// revealing details of the underlying error.
+func errorMessage(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "Sign in with your directory user name and password to continue."
+	case http.StatusForbidden:
+		return "You are not allowed to do that."
+	case http.StatusNotFound:
+		return "The contact or page you asked for does not exist."
+	case http.StatusBadGateway:
+		return "The directory could not complete the request."
+	case http.StatusServiceUnavailable:
+		return "The directory is unavailable right now. Please try again later."
+	default:
+		return "Something went wrong while handling the request."
+	}
+}
+
+// showError logs err and renders the error page with the matching status.
+func (s *server) showError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	log.Printf("%s %s: %d: %v", r.Method, r.URL.Path, status, err)
+	if strings.HasPrefix(r.URL.Path, s.apiRoute()+"/") {
+		writeAPIError(w, status, errors.New(errorMessage(status)))
+		return
+	}
+
+	var b bytes.Buffer
+	if err = s.tmpl.ExecuteTemplate(
+		&b, errorTemplate, viewData{
+			Title:   makeTitle("Error", http.StatusText(status)),
+			Status:  status,
+			Message: errorMessage(status),
+			Request: r,
+		}); err != nil {
+		log.Printf("executing error template: %v", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b.Bytes())
+}
+
+// render executes the named template into a buffer so that a failure can
+// still be reported with the error page instead of a half written one.
+func (s *server) render(w http.ResponseWriter, r *http.Request, status int, name string, data viewData) {
+	var b bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		s.showError(w, r, fmt.Errorf("executing template %s: %w", name, err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b.Bytes())
+}
+
+// recoverPanics turns a panicking handler into a logged 500 error page
+// rather than a dropped connection.
+func (s *server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			log.Printf("panic serving %s: %v\n%s", r.URL.Path, recovered, debug.Stack())
+			s.showError(w, r, &statusError{http.StatusInternalServerError, fmt.Errorf("panic: %v", recovered)})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
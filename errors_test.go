@@ -0,0 +1,84 @@
+package contacts
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestErrorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("finding: %w", ErrNotFound), http.StatusNotFound},
+		{directoryError("connect", ldap.NewError(ldap.ErrorNetwork, errors.New("refused"))), http.StatusServiceUnavailable},
+		{directoryError("search", ldap.NewError(ldap.LDAPResultBusy, errors.New("busy"))), http.StatusServiceUnavailable},
+		{directoryError("bind", ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("denied"))), http.StatusBadGateway},
+		{fmt.Errorf("saving changes: %w", directoryError("modify", ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("no")))), http.StatusBadGateway},
+		{errPageNotFound, http.StatusNotFound},
+		{errors.New("template"), http.StatusInternalServerError},
+	} {
+		if got := errorStatus(tc.err); got != tc.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	h, err := NewWebServer("/contacts/", Config{Host: host, Port: port}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/contacts/list", http.StatusServiceUnavailable},
+		{"/contacts/detail?dn=cn%3Dnobody", http.StatusServiceUnavailable},
+		{"/contacts/nowhere/", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != tc.want || !strings.Contains(rec.Body.String(), "<h1>Error :: "+http.StatusText(tc.want)) {
+			t.Errorf("GET %s = %d\n%s", tc.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	config := Config{Host: host, Port: port}
+	if err := Save(config, nil, &Contact{Name: "Jane Doe"}); errorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("create: %v = %d", err, errorStatus(err))
+	}
+	if err := Save(config, &Contact{ID: "cn=Jane Doe"}, &Contact{ID: "cn=Jane Doe", Name: "Jane Roe"}); errorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("save: %v = %d", err, errorStatus(err))
+	}
+	if err := Delete(config, "cn=Jane Doe"); errorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("delete: %v = %d", err, errorStatus(err))
+	}
+
+	s := &server{baseRoute: "/contacts/", tmpl: template.New("").Funcs(templateFuncs)}
+	if err = s.init(Templates); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/contacts/list/", nil))
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "boom") {
+		t.Errorf("panic = %d\n%s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,479 @@
+package contacts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// gatewayMaxRequest caps the size of the LDAP requests a Gateway reads;
+	// binds and searches are far smaller.
+	gatewayMaxRequest = 64 << 10
+	// gatewayIdleTimeout is how long a Gateway waits for the next request
+	// on a connection, and for a response to be written.
+	gatewayIdleTimeout = 2 * time.Minute
+	// gatewayMaxConns is the default limit of concurrent connections.
+	gatewayMaxConns = 100
+)
+
+// Source returns the contacts served by a Gateway.
+type Source func() ([]*Contact, error)
+
+// DirectorySource serves the contacts of the directory in config.
+func DirectorySource(config Config) Source {
+	return func() ([]*Contact, error) { return List(config, nil) }
+}
+
+// VCardFileSource serves the contacts in a vCard file, reading it again
+// whenever it changes.
+func VCardFileSource(name string) Source {
+	var (
+		mu       sync.Mutex
+		modified time.Time
+		cached   []*Contact
+	)
+	return func() ([]*Contact, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().Equal(modified) {
+			return cached, nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		records, err := ParseVCards(f)
+		if err != nil {
+			return nil, err
+		}
+		modified, cached = info.ModTime(), records
+		return cached, nil
+	}
+}
+
+// Gateway is a read-only LDAP server answering bind and search requests
+// from a Source, so that mail clients can look up contacts that are not
+// kept in a directory.
+type Gateway struct {
+	// BaseDN is the DN the contacts are served below, e.g.
+	// "ou=contacts,dc=example,dc=org".
+	BaseDN string
+	Source Source
+	// BindDN and Password, when set, are required to bind before
+	// searching. Otherwise anonymous searches are allowed.
+	BindDN   string
+	Password string
+	// SizeLimit caps the number of entries returned by a search.
+	SizeLimit int
+	// MaxConns limits the connections served at once; further connections
+	// are closed. It defaults to 100.
+	MaxConns int
+}
+
+// gatewayEntry is a contact as an LDAP entry; attributes are keyed by their
+// lower case name.
+type gatewayEntry struct {
+	dn    string
+	names map[string]string
+	attrs map[string][]string
+}
+
+// ListenAndServe serves LDAP on the TCP address addr.
+func (g *Gateway) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(l)
+}
+
+// Serve answers the LDAP connections accepted from l.
+func (g *Gateway) Serve(l net.Listener) error {
+	defer l.Close()
+	max := g.MaxConns
+	if max <= 0 {
+		max = gatewayMaxConns
+	}
+	conns := make(chan struct{}, max)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		select {
+		case conns <- struct{}{}:
+		default:
+			log.Printf("ldap gateway %s: too many connections", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer func() { <-conns }()
+			g.serveConn(conn)
+		}()
+	}
+}
+
+func (g *Gateway) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	bound := g.BindDN == ""
+	for {
+		conn.SetDeadline(time.Now().Add(gatewayIdleTimeout))
+		packet, err := readRequest(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("ldap gateway %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			var code int
+			code, bound = g.bind(op)
+			responses = append(responses, ldapResult(id, ldap.ApplicationBindResponse, code, ""))
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				responses = append(responses, ldapResult(id, ldap.ApplicationSearchResultDone,
+					ldap.LDAPResultInsufficientAccessRights, "bind required"))
+				break
+			}
+			responses = g.search(id, op)
+		case ldap.ApplicationAbandonRequest:
+		default:
+			// Every other request's response tag follows its own.
+			responses = append(responses, ldapResult(id, op.Tag+1, ldap.LDAPResultUnwillingToPerform, "read only"))
+		}
+		for _, response := range responses {
+			if _, err = conn.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readRequest reads an LDAP message of at most gatewayMaxRequest bytes,
+// checking its length before any of it is allocated.
+func readRequest(r *bufio.Reader) (*ber.Packet, error) {
+	header, err := r.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	size, length := 2, int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, errors.New("unsupported request length")
+		}
+		if header, err = r.Peek(2 + n); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range header[2:] {
+			length = length<<8 | int(b)
+		}
+		size += n
+	}
+	if length < 0 || length > gatewayMaxRequest-size {
+		return nil, fmt.Errorf("request of %d bytes is too large", length)
+	}
+	return ber.ReadPacket(io.LimitReader(r, int64(size+length)))
+}
+
+// bind checks a simple bind request, returning the result code and
+// whether the connection may search.
+func (g *Gateway) bind(op *ber.Packet) (int, bool) {
+	if len(op.Children) < 3 {
+		return ldap.LDAPResultProtocolError, false
+	}
+	name, auth := packetString(op.Children[1]), op.Children[2]
+	if auth.Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported, false
+	}
+	password := packetString(auth)
+	switch {
+	case g.BindDN == "":
+		return ldap.LDAPResultSuccess, true
+	case name == "" && password == "":
+		// Anonymous binds succeed but cannot search.
+		return ldap.LDAPResultSuccess, false
+	case normalizeDN(name) == normalizeDN(g.BindDN) && password == g.Password:
+		return ldap.LDAPResultSuccess, true
+	}
+	return ldap.LDAPResultInvalidCredentials, false
+}
+
+func (g *Gateway) search(id int64, op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "")}
+	}
+	base := normalizeDN(packetString(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	limit, _ := op.Children[3].Value.(int64)
+	typesOnly, _ := op.Children[5].Value.(bool)
+	filter := op.Children[6]
+	var wanted []string
+	for _, attr := range op.Children[7].Children {
+		wanted = append(wanted, packetString(attr))
+	}
+	if g.SizeLimit > 0 && (limit == 0 || limit > int64(g.SizeLimit)) {
+		limit = int64(g.SizeLimit)
+	}
+
+	var candidates []gatewayEntry
+	switch {
+	case base == "" && scope == ldap.ScopeBaseObject:
+		candidates = []gatewayEntry{g.rootDSE()}
+	case base == normalizeDN(g.BaseDN) && scope == ldap.ScopeBaseObject:
+		candidates = []gatewayEntry{g.baseEntry()}
+	case base == "" || strings.HasSuffix(","+normalizeDN(g.BaseDN), ","+base) || strings.HasSuffix(base, ","+normalizeDN(g.BaseDN)):
+		records, err := g.Source()
+		if err != nil {
+			log.Printf("ldap gateway: %v", err)
+			return []*ber.Packet{ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultUnavailable, "contacts unavailable")}
+		}
+		for _, contact := range records {
+			entry := g.entry(contact)
+			if entry.within(base, int(scope), normalizeDN(g.BaseDN)) {
+				candidates = append(candidates, entry)
+			}
+		}
+	default:
+		return []*ber.Packet{ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject, "")}
+	}
+
+	var responses []*ber.Packet
+	for _, entry := range candidates {
+		if !entry.matches(filter) {
+			continue
+		}
+		if limit > 0 && int64(len(responses)) == limit {
+			return append(responses, ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, entry.packet(id, wanted, typesOnly))
+	}
+	return append(responses, ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func (g *Gateway) rootDSE() gatewayEntry {
+	return newGatewayEntry("", map[string][]string{
+		"objectClass":          {"top"},
+		"namingContexts":       {g.BaseDN},
+		"supportedLDAPVersion": {"3"},
+	})
+}
+
+func (g *Gateway) baseEntry() gatewayEntry {
+	return newGatewayEntry(g.BaseDN, map[string][]string{
+		"objectClass": {"top", "organizationalUnit"},
+	})
+}
+
+// entry serves only the attributes mapped to contact fields; anything else
+// in the directory entry, such as a userPassword, stays private.
+func (g *Gateway) entry(c *Contact) gatewayEntry {
+	attrs := map[string][]string{}
+	for k, v := range c.attributeValues() {
+		attrs[k] = v
+	}
+	attrs["cn"] = []string{firstNonEmpty(c.CommonName, c.DisplayName())}
+	attrs["displayName"] = []string{c.DisplayName()}
+	attrs["objectClass"] = []string{"top", "person", "organizationalPerson", "inetOrgPerson"}
+	return newGatewayEntry("cn="+escapeDNValue(attrs["cn"][0])+","+g.BaseDN, attrs)
+}
+
+func newGatewayEntry(dn string, attrs map[string][]string) gatewayEntry {
+	e := gatewayEntry{dn: dn, names: map[string]string{}, attrs: map[string][]string{}}
+	for k, v := range attrs {
+		if len(v) == 0 {
+			continue
+		}
+		e.names[strings.ToLower(k)] = k
+		e.attrs[strings.ToLower(k)] = v
+	}
+	return e
+}
+
+// within reports whether the entry is in the scope of a search of base,
+// given that it is an immediate child of parent.
+func (e gatewayEntry) within(base string, scope int, parent string) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return normalizeDN(e.dn) == base
+	case ldap.ScopeSingleLevel:
+		return base == parent
+	}
+	return true
+}
+
+// matches evaluates an LDAP filter against the entry. Attribute names and
+// values are compared case insensitively.
+func (e gatewayEntry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !e.matches(child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if e.matches(child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !e.matches(filter.Children[0])
+	case ldap.FilterPresent:
+		return len(e.attrs[strings.ToLower(packetString(filter))]) > 0
+	}
+	if len(filter.Children) != 2 {
+		return false
+	}
+	values := e.attrs[strings.ToLower(packetString(filter.Children[0]))]
+	for _, value := range values {
+		value = strings.ToLower(value)
+		switch filter.Tag {
+		case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+			if value == strings.ToLower(packetString(filter.Children[1])) {
+				return true
+			}
+		case ldap.FilterGreaterOrEqual:
+			if value >= strings.ToLower(packetString(filter.Children[1])) {
+				return true
+			}
+		case ldap.FilterLessOrEqual:
+			if value <= strings.ToLower(packetString(filter.Children[1])) {
+				return true
+			}
+		case ldap.FilterSubstrings:
+			if matchesSubstrings(value, filter.Children[1].Children) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		sub := strings.ToLower(packetString(part))
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, sub) {
+				return false
+			}
+			value = value[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, sub)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// packet returns the search result entry with the wanted attributes, or
+// all of them when none or "*" are wanted.
+func (e gatewayEntry) packet(id int64, wanted []string, typesOnly bool) *ber.Packet {
+	all := len(wanted) == 0
+	want := map[string]bool{}
+	for _, name := range wanted {
+		all = all || name == "*"
+		want[strings.ToLower(name)] = true
+	}
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for key, values := range e.attrs {
+		if !all && !want[key] {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.names[key], "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		if !typesOnly {
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	entry.AppendChild(attrs)
+	return ldapMessage(id, entry)
+}
+
+func ldapResult(id int64, tag ber.Tag, code int, message string) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return ldapMessage(id, result)
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+// packetString returns the string value of a primitive packet, whatever
+// its class.
+func packetString(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	if p.Data == nil {
+		return ""
+	}
+	return p.Data.String()
+}
+
+// normalizeDN lower cases dn and removes the spaces around its separators.
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		if eq := strings.Index(part, "="); eq >= 0 {
+			part = strings.TrimSpace(part[:eq]) + "=" + strings.TrimSpace(part[eq+1:])
+		}
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,134 @@
+package contacts
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestGateway(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := &Gateway{
+		BaseDN:   "ou=contacts,dc=example,dc=org",
+		BindDN:   "cn=reader,dc=example,dc=org",
+		Password: "secret",
+		Source: func() ([]*Contact, error) {
+			return []*Contact{
+				{Name: "Jane Doe", First: "Jane", Last: "Doe", Email: []string{"jane@example.com"},
+					Extra: map[string][]string{"userPassword": {"{SSHA}secret"}}},
+				{Name: "John Roe", First: "John", Last: "Roe", Email: []string{"john@example.org"}},
+			}, nil
+		},
+	}
+	go gateway.Serve(ln)
+	defer ln.Close()
+
+	conn, err := ldap.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	search := ldap.NewSearchRequest(gateway.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(|(cn=*jane*)(mail=*jane*)(sn=*jane*)(givenName=*jane*))", []string{"cn", "mail"}, nil)
+	if _, err = conn.Search(search); !ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights) {
+		t.Errorf("search before bind: %v", err)
+	}
+	if err = conn.Bind("cn=reader,dc=example,dc=org", "wrong"); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Errorf("bind with a wrong password: %v", err)
+	}
+	if err = conn.Bind("CN=reader, dc=example, dc=org", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := conn.Search(search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 {
+		t.Fatalf("found %d entries", len(result.Entries))
+	}
+	entry := result.Entries[0]
+	if entry.DN != "cn=Jane Doe,ou=contacts,dc=example,dc=org" || entry.GetAttributeValue("mail") != "jane@example.com" || entry.GetAttributeValue("sn") != "" {
+		t.Errorf("entry = %s %v", entry.DN, entry.Attributes)
+	}
+	search.Attributes = nil
+	if result, err = conn.Search(search); err != nil || len(result.Entries) != 1 {
+		t.Fatalf("search all attributes: %v", err)
+	}
+	if got := result.Entries[0].GetAttributeValues("userPassword"); len(got) != 0 {
+		t.Errorf("served userPassword %v", got)
+	}
+
+	for filter, want := range map[string]int{
+		"(objectClass=*)":                     2,
+		"(&(sn=Roe)(mail=*.org))":             1,
+		"(!(givenName=jane))":                 1,
+		"(mail=jo*@example.*)":                1,
+		"(&(objectClass=person)(cn=nobody*))": 0,
+	} {
+		search.Filter = filter
+		if result, err = conn.Search(search); err != nil {
+			t.Errorf("%s: %v", filter, err)
+		} else if len(result.Entries) != want {
+			t.Errorf("%s: %d entries, want %d", filter, len(result.Entries), want)
+		}
+	}
+
+	search.BaseDN = "ou=elsewhere,dc=example,dc=org"
+	if _, err = conn.Search(search); !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		t.Errorf("search outside the base: %v", err)
+	}
+}
+
+func TestGatewayLimits(t *testing.T) {
+	serve := func(g *Gateway) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go g.Serve(ln)
+		return ln.Addr().String()
+	}
+	dial := func(addr string) net.Conn {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	closed := func(conn net.Conn) bool {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		return err == io.EOF
+	}
+	source := func() ([]*Contact, error) { return nil, nil }
+
+	huge := dial(serve(&Gateway{BaseDN: "ou=contacts,dc=example,dc=org", Source: source}))
+	// A message claiming to be almost 2 GiB long.
+	huge.Write([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff})
+	if !closed(huge) {
+		t.Error("oversized request not refused")
+	}
+
+	addr := serve(&Gateway{BaseDN: "ou=contacts,dc=example,dc=org", Source: source, MaxConns: 1})
+	first, err := ldap.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if err = first.UnauthenticatedBind(""); err != nil {
+		t.Fatal(err)
+	}
+	if !closed(dial(addr)) {
+		t.Error("connection over the limit not closed")
+	}
+}
@@ -1,5 +1,8 @@
 module jw4.us/contacts
 
-go 1.14
+go 1.20
 
-require github.com/go-ldap/ldap/v3 v3.1.7
+require (
+	github.com/go-asn1-ber/asn1-ber v1.3.1
+	github.com/go-ldap/ldap/v3 v3.1.7
+)
@@ -0,0 +1,64 @@
+package contacts
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// HealthStatus is the JSON body of health check responses.
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health answers liveness and readiness probes for a web server using
+// Config and Templates, which default to the built in Templates when nil.
+type Health struct {
+	Config    Config
+	Templates fs.FS
+
+	draining int32
+}
+
+// Live reports that the process is serving requests.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// Ready reports whether requests can be served: the directory can be
+// reached and the templates parse. It fails once Drain has been called.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	status := HealthStatus{Status: "ok", Checks: map[string]string{
+		"directory": "ok",
+		"templates": "ok",
+	}}
+	if err := Ping(h.Config, healthCheckTimeout); err != nil {
+		status.Status, status.Checks["directory"] = "unavailable", err.Error()
+	}
+	templates := h.Templates
+	if templates == nil {
+		templates = Templates
+	}
+	s := &server{tmpl: template.New("").Funcs(templateFuncs)}
+	if err := s.init(templates); err != nil {
+		status.Status, status.Checks["templates"] = "unavailable", err.Error()
+	}
+	if atomic.LoadInt32(&h.draining) != 0 {
+		status.Status = "draining"
+	}
+
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+// Drain makes Ready fail so that load balancers stop sending requests
+// while the server shuts down.
+func (h *Health) Drain() { atomic.StoreInt32(&h.draining, 1) }
@@ -0,0 +1,68 @@
+package contacts
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHealth(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	check := func(handler http.HandlerFunc, wantCode int) HealthStatus {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != wantCode {
+			t.Errorf("status %d, want %d: %s", w.Code, wantCode, w.Body)
+		}
+		var status HealthStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	h := &Health{Config: Config{Host: host, Port: port}}
+	if status := check(h.Live, http.StatusOK); status.Status != "ok" {
+		t.Errorf("live: got %q", status.Status)
+	}
+
+	status := check(h.Ready, http.StatusServiceUnavailable)
+	if status.Status != "unavailable" || status.Checks["directory"] == "ok" {
+		t.Errorf("ready without directory: got %+v", status)
+	}
+	if status.Checks["templates"] != "ok" {
+		t.Errorf("templates: got %q", status.Checks["templates"])
+	}
+
+	h.Templates = fstest.MapFS{"broken.html": {Data: []byte("{{ end }}")}}
+	if status := check(h.Ready, http.StatusServiceUnavailable); status.Checks["templates"] == "ok" {
+		t.Errorf("broken templates reported ok")
+	}
+
+	h.Drain()
+	if status := check(h.Live, http.StatusOK); status.Status != "ok" {
+		t.Errorf("live while draining: got %q", status.Status)
+	}
+	if status := check(h.Ready, http.StatusServiceUnavailable); status.Status != "draining" {
+		t.Errorf("ready while draining: got %q", status.Status)
+	}
+}
+
+func TestCloseChangeSubscriptions(t *testing.T) {
+	events, _, cancel := SubscribeChanges(0)
+	defer cancel()
+	CloseChangeSubscriptions()
+	if _, ok := <-events; ok {
+		t.Errorf("subscription still open")
+	}
+}
@@ -0,0 +1,111 @@
+package contacts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	icsProductID = "-//jw4.us//Contacts//EN"
+	icsDate      = "20060102"
+	icsDateTime  = "20060102T150405Z"
+
+	// icsYearlessStart is the year used to start the recurrence of
+	// birthdays whose year is unknown. It is a leap year so that February
+	// 29 stays a real date.
+	icsYearlessStart = 1972
+)
+
+// WriteICS writes an iCalendar with a yearly recurring all-day event for the
+// birthday of each contact. For birthdays with a known year, the occurrences
+// in the year of now and the following year are overridden to show the age.
+func WriteICS(w io.Writer, name string, contacts []*Contact, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + icsProductID,
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + escapeICS(name),
+	}
+	for _, contact := range contacts {
+		lines = append(lines, contact.birthdayEvents(now)...)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for _, line := range lines {
+		if _, err := bw.WriteString(foldLine(line)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// BirthdayUID is the stable iCalendar UID of the contact's birthday event.
+func (c *Contact) BirthdayUID() string {
+	return c.UUID() + "-birthday@contacts"
+}
+
+func (c *Contact) birthdayEvents(now time.Time) []string {
+	if c == nil || c.ID == "" || c.Birthday.IsZero() {
+		return nil
+	}
+	birthday := c.Birthday
+	start := birthday
+	if start.Year() == 0 {
+		start = time.Date(icsYearlessStart, birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	rule := "RRULE:FREQ=YEARLY"
+	if birthday.Month() == time.February && birthday.Day() == 29 {
+		// Celebrate on February 28 in common years.
+		rule = "RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1"
+	}
+	name := c.DisplayName()
+	stamp := now.UTC().Format(icsDateTime)
+
+	event := func(date time.Time, summary string, extra ...string) []string {
+		lines := []string{
+			"BEGIN:VEVENT",
+			"UID:" + c.BirthdayUID(),
+			"DTSTAMP:" + stamp,
+		}
+		lines = append(lines, extra...)
+		return append(lines,
+			"DTSTART;VALUE=DATE:"+date.Format(icsDate),
+			"DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format(icsDate),
+			"SUMMARY:"+escapeICS(summary),
+			"TRANSP:TRANSPARENT",
+			"CATEGORIES:BIRTHDAY",
+			"END:VEVENT",
+		)
+	}
+
+	lines := event(start, fmt.Sprintf("%s's Birthday", name), rule)
+	if birthday.Year() == 0 {
+		return lines
+	}
+	for _, year := range []int{now.Year(), now.Year() + 1} {
+		occurrence := occurrenceIn(birthday, year)
+		if occurrence.Before(start) || year == birthday.Year() {
+			continue
+		}
+		lines = append(lines, event(occurrence,
+			fmt.Sprintf("%s's Birthday (%d)", name, year-birthday.Year()),
+			"RECURRENCE-ID;VALUE=DATE:"+occurrence.Format(icsDate))...)
+	}
+	return lines
+}
+
+// occurrenceIn returns the date a birthday is celebrated in year, moving
+// February 29 to February 28 in common years.
+func occurrenceIn(birthday time.Time, year int) time.Time {
+	date := time.Date(year, birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC)
+	if date.Month() != birthday.Month() {
+		date = date.AddDate(0, 0, -date.Day())
+	}
+	return date
+}
+
+// escapeICS escapes iCalendar TEXT values, which use the same rules as vCard.
+func escapeICS(value string) string { return escapeVCard(value) }
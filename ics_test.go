@@ -0,0 +1,42 @@
+package contacts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteICS(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	list := []*Contact{
+		{ID: "cn=Jane,ou=contacts", Name: "Jane", Birthday: time.Date(1980, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{ID: "cn=John,ou=contacts", Name: "John", Birthday: time.Date(0, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "cn=Mary,ou=contacts", Name: "Mary", Birthday: time.Date(0, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{ID: "cn=None,ou=contacts", Name: "None"},
+	}
+	var b bytes.Buffer
+	if err := WriteICS(&b, "Birthdays", list, now); err != nil {
+		t.Fatal(err)
+	}
+	ics := b.String()
+	for _, expected := range []string{
+		"UID:" + list[0].BirthdayUID() + "\r\n",
+		"DTSTART;VALUE=DATE:19800229\r\n",
+		"RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1\r\n",
+		"RECURRENCE-ID;VALUE=DATE:20260228\r\n",
+		"SUMMARY:Jane's Birthday (46)\r\n",
+		"SUMMARY:Jane's Birthday (47)\r\n",
+		"DTSTART;VALUE=DATE:19720601\r\n",
+		"SUMMARY:John's Birthday\r\n",
+		"DTSTART;VALUE=DATE:19720229\r\n",
+		"SUMMARY:Mary's Birthday\r\n",
+	} {
+		if !strings.Contains(ics, expected) {
+			t.Errorf("expected %q in:\n%s", expected, ics)
+		}
+	}
+	if strings.Count(ics, "BEGIN:VEVENT") != 5 {
+		t.Errorf("expected 5 events:\n%s", ics)
+	}
+}
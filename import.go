@@ -0,0 +1,189 @@
+package contacts
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ImportItem describes what importing a single incoming contact would do.
+type ImportItem struct {
+	// Incoming is the contact as read from the import source.
+	Incoming *Contact
+	// Existing is the matching contact already in the directory, if any.
+	Existing *Contact
+	// Result is the contact that would be saved: Incoming for a create, or
+	// Existing merged with Incoming for an update.
+	Result *Contact
+	// Changes is the difference between Existing and Result.
+	Changes map[string]map[string][]string
+	// MatchedBy names the field used to find Existing.
+	MatchedBy string
+	// Err is set when Result cannot be saved.
+	Err error
+}
+
+// Create reports whether the item would create a new contact.
+func (i *ImportItem) Create() bool { return i.Existing == nil }
+
+// Unchanged reports whether the item would update a contact without
+// changing anything.
+func (i *ImportItem) Unchanged() bool {
+	return i.Existing != nil && len(flattenChanges(i.Changes)) == 0
+}
+
+// ChangeSummary lists the changed attributes as "op attribute" strings.
+func (i *ImportItem) ChangeSummary() []string { return flattenChanges(i.Changes) }
+
+// PlanImport matches each incoming contact against the contacts already in
+// the directory and describes the resulting creates and updates without
+// writing anything.
+func PlanImport(config Config, incoming []*Contact) ([]*ImportItem, error) {
+	existing, err := List(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return planImport(existing, incoming, config.DefaultRegion), nil
+}
+
+// PlanImportFrom is PlanImport against an already fetched list of existing
+// contacts, such as one read through the API.
+func PlanImportFrom(existing, incoming []*Contact, region string) []*ImportItem {
+	return planImport(existing, incoming, region)
+}
+
+// ApplyImport saves every item that has changes and no error, returning the
+// number of contacts written and the first error encountered.
+func ApplyImport(config Config, items []*ImportItem) (int, error) {
+	var (
+		saved    int
+		firstErr error
+	)
+	for _, item := range items {
+		if item.Err != nil || item.Unchanged() {
+			continue
+		}
+		if err := Save(config, item.Existing, item.Result); err != nil {
+			log.Printf("error importing %q: %v", item.Result.DisplayName(), err)
+			item.Err = err
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		saved++
+	}
+	return saved, firstErr
+}
+
+func planImport(existing, incoming []*Contact, region string) []*ImportItem {
+	var items []*ImportItem
+	for _, in := range incoming {
+		item := &ImportItem{Incoming: in, Result: in}
+		item.Existing, item.MatchedBy = matchContact(in, existing, region)
+		if item.Existing != nil {
+			item.Result = mergeContact(item.Existing, in)
+			item.Changes = item.Existing.changes(item.Result)
+		}
+		if err := item.Result.Validate(); err != nil {
+			item.Err = err
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// matchContact finds the contact in existing that in most likely describes,
+// trying email addresses first, then phone numbers, then the name.
+func matchContact(in *Contact, existing []*Contact, region string) (*Contact, string) {
+	for _, candidate := range existing {
+		if overlaps(in.Email, candidate.Email, strings.ToLower) {
+			return candidate, "Email"
+		}
+	}
+	for _, candidate := range existing {
+		normalize := func(number string) string {
+			normalized, _ := NormalizePhone(number, firstNonEmpty(in.Country, candidate.Country, region))
+			return normalized
+		}
+		if overlaps(in.Phone, candidate.Phone, normalize) {
+			return candidate, "Phone"
+		}
+	}
+	name := strings.ToLower(strings.TrimSpace(in.DisplayName()))
+	for _, candidate := range existing {
+		if name != "" && name == strings.ToLower(strings.TrimSpace(candidate.DisplayName())) {
+			return candidate, "Name"
+		}
+	}
+	return nil, ""
+}
+
+// mergeContact returns a copy of existing updated with the values set in
+// incoming. List values are combined.
+func mergeContact(existing, incoming *Contact) *Contact {
+	merged := *existing
+	merged.Extra = nil
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set(&merged.Name, incoming.Name)
+	set(&merged.Prefix, incoming.Prefix)
+	set(&merged.First, incoming.First)
+	set(&merged.Middle, incoming.Middle)
+	set(&merged.Last, incoming.Last)
+	set(&merged.Suffix, incoming.Suffix)
+	set(&merged.PhoneticFirst, incoming.PhoneticFirst)
+	set(&merged.PhoneticLast, incoming.PhoneticLast)
+	if incoming.HasAddress() {
+		merged.Street = incoming.Street
+		merged.City = incoming.City
+		merged.State = incoming.State
+		merged.Zip = incoming.Zip
+	}
+	set(&merged.Country, incoming.Country)
+	if b := incoming.Birthday; !b.IsZero() {
+		// Keep a known year rather than replace it with a year-less date.
+		if b.Year() != 0 || b.Month() != existing.Birthday.Month() || b.Day() != existing.Birthday.Day() {
+			merged.Birthday = b
+		}
+	}
+	merged.Nickname = dedupe(append(append([]string(nil), existing.Nickname...), incoming.Nickname...))
+	merged.Email = dedupe(append(append([]string(nil), existing.Email...), incoming.Email...))
+	merged.Phone = dedupe(append(append([]string(nil), existing.Phone...), incoming.Phone...))
+	merged.Labels = dedupe(append(append([]string(nil), existing.Labels...), incoming.Labels...))
+	return &merged
+}
+
+func overlaps(a, b []string, normalize func(string) string) bool {
+	seen := map[string]bool{}
+	for _, v := range a {
+		if v = normalize(strings.TrimSpace(v)); v != "" {
+			seen[v] = true
+		}
+	}
+	for _, v := range b {
+		if seen[normalize(strings.TrimSpace(v))] {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenChanges(changes map[string]map[string][]string) []string {
+	var summary []string
+	for _, op := range []string{"add", "modify", "replace", "delete"} {
+		var attrs []string
+		for attr := range changes[op] {
+			attrs = append(attrs, attr)
+		}
+		sort.Strings(attrs)
+		for _, attr := range attrs {
+			summary = append(summary, fmt.Sprintf("%s %s: %s", op, attr, strings.Join(changes[op][attr], ", ")))
+		}
+	}
+	return summary
+}
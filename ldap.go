@@ -1,28 +1,75 @@
 package contacts
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"reflect"
+	"strings"
 	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
 )
 
+// DirectoryError is a failure talking to the LDAP directory.
+type DirectoryError struct {
+	Op  string
+	Err error
+}
+
+func (e *DirectoryError) Error() string { return fmt.Sprintf("directory %s: %v", e.Op, e.Err) }
+func (e *DirectoryError) Unwrap() error { return e.Err }
+
+// Unavailable reports whether the directory could not be reached or is
+// refusing work, rather than rejecting this particular operation.
+func (e *DirectoryError) Unavailable() bool {
+	return hasResultCode(e.Err, ldap.ErrorNetwork) ||
+		hasResultCode(e.Err, ldap.LDAPResultBusy) ||
+		hasResultCode(e.Err, ldap.LDAPResultUnavailable)
+}
+
+func directoryError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DirectoryError{Op: op, Err: err}
+}
+
+// hasResultCode is ldap.IsErrorWithCode for wrapped errors.
+func hasResultCode(err error, code uint16) bool {
+	var ldapErr *ldap.Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == code
+}
+
 func connect(config Config) (*ldap.Conn, error) {
 	conn, err := ldap.Dial("tcp", fmt.Sprintf("%s:%s", config.Host, config.Port))
 	if err != nil {
-		return nil, err
+		return nil, directoryError("connect", err)
 	}
 
 	err = conn.Bind(config.Username, config.Password)
 	if err != nil {
-		return nil, err
+		conn.Close()
+		return nil, directoryError("bind", err)
 	}
 
 	return conn, nil
 }
 
+// Ping checks that the directory can be reached and bound to within
+// timeout.
+func Ping(config Config, timeout time.Duration) error {
+	conn, err := ldap.DialURL("ldap://"+net.JoinHostPort(config.Host, config.Port),
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return directoryError("connect", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(timeout)
+	return directoryError("bind", conn.Bind(config.Username, config.Password))
+}
+
 func del(config Config, request *ldap.DelRequest) error {
 	conn, err := connect(config)
 	if err != nil {
@@ -30,7 +77,7 @@ func del(config Config, request *ldap.DelRequest) error {
 	}
 	defer conn.Close()
 
-	return conn.Del(request)
+	return directoryError("delete", conn.Del(request))
 }
 
 func save(config Config, request *ldap.ModifyRequest) error {
@@ -41,7 +88,7 @@ func save(config Config, request *ldap.ModifyRequest) error {
 	}
 	defer conn.Close()
 
-	return conn.Modify(request)
+	return directoryError("modify", conn.Modify(request))
 }
 
 func create(config Config, request *ldap.AddRequest) error {
@@ -52,7 +99,7 @@ func create(config Config, request *ldap.AddRequest) error {
 	}
 	defer conn.Close()
 
-	return conn.Add(request)
+	return directoryError("add", conn.Add(request))
 }
 
 func getEntries(config Config, request *ldap.SearchRequest, handle func(*ldap.Entry)) error {
@@ -64,7 +111,7 @@ func getEntries(config Config, request *ldap.SearchRequest, handle func(*ldap.En
 
 	s, err := conn.Search(request)
 	if err != nil {
-		return err
+		return directoryError("search", err)
 	}
 
 	for _, e := range s.Entries {
@@ -104,6 +151,43 @@ func setAttributes(c interface{}, entry *ldap.Entry) {
 	})
 }
 
+// unmappedAttributes collects the attributes of entry that have no
+// corresponding ldap tagged field in c.
+func unmappedAttributes(c interface{}, entry *ldap.Entry) map[string][]string {
+	if entry == nil {
+		return nil
+	}
+	mapped := map[string]bool{"objectclass": true}
+	for _, n := range attributeNames(c) {
+		mapped[strings.ToLower(n)] = true
+	}
+	var extra map[string][]string
+	for _, attr := range entry.Attributes {
+		if mapped[strings.ToLower(attr.Name)] || len(attr.Values) == 0 {
+			continue
+		}
+		if extra == nil {
+			extra = map[string][]string{}
+		}
+		extra[attr.Name] = attr.Values
+	}
+	return extra
+}
+
+// isMappedAttribute reports whether name is handled by an ldap tagged field
+// of c, or is otherwise reserved.
+func isMappedAttribute(c interface{}, name string) bool {
+	if strings.EqualFold(name, "objectClass") {
+		return true
+	}
+	for _, n := range attributeNames(c) {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func attributeNames(c interface{}) []string {
 	var names []string
 	if c == nil {
@@ -0,0 +1,424 @@
+package contacts
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// LDIFAdd imports content records as new entries.
+	LDIFAdd = "add"
+	// LDIFModify imports content records as modify records replacing the
+	// attributes they list, adding any entry that does not exist yet.
+	LDIFModify = "modify"
+
+	ldifLineLength = 76
+)
+
+// LDIFRecord is a single LDIF content or change record.
+type LDIFRecord struct {
+	DN string
+	// ChangeType is empty for content records, otherwise one of "add",
+	// "modify" or "delete".
+	ChangeType string
+	// Attributes of content and add records.
+	Attributes []ldap.Attribute
+	// Changes of modify records.
+	Changes []ldap.Change
+}
+
+// ExportLDIF writes the entries selected by labels, exactly as List sees
+// them, to w as LDIF.
+func ExportLDIF(config Config, w io.Writer, labels []string) error {
+	var entries []*ldap.Entry
+	err := getEntries(config, buildSearchRequest(config.BaseDN, labels), func(e *ldap.Entry) {
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return err
+	}
+	return WriteLDIF(w, entries)
+}
+
+// WriteLDIF writes entries to w as LDIF content records.
+func WriteLDIF(w io.Writer, entries []*ldap.Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "version: 1\n")
+	for _, entry := range entries {
+		fmt.Fprint(bw, "\n", ldifLine("dn", entry.DN))
+		for _, attr := range entry.Attributes {
+			for _, value := range attr.Values {
+				fmt.Fprint(bw, ldifLine(attr.Name, value))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadLDIF parses the content and change records in r.
+func ReadLDIF(r io.Reader) ([]*LDIFRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var (
+		records []*LDIFRecord
+		lines   []string
+		number  int
+	)
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		record, err := parseLDIFRecord(lines)
+		if err != nil {
+			return fmt.Errorf("record ending line %d: %v", number, err)
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+		lines = nil
+		return nil
+	}
+	for scanner.Scan() {
+		number++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, " "):
+			if len(lines) > 0 {
+				lines[len(lines)-1] += line[1:]
+			}
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ImportLDIF applies records to the directory, rebasing each DN onto the
+// configured BaseDN. Content records are handled according to mode, LDIFAdd
+// or LDIFModify; change records are applied as written. The contacts they
+// leave are validated and their phone numbers normalized as Save does. It
+// returns a line describing the outcome of each record, and the first error
+// encountered.
+func ImportLDIF(config Config, records []*LDIFRecord, mode string) ([]string, error) {
+	var (
+		report   []string
+		firstErr error
+	)
+	for _, record := range records {
+		dn, err := rebaseDN(record.DN, config.BaseDN)
+		if err == nil {
+			err = checkLDIFRecord(config, record, dn)
+		}
+		action := ""
+		if err == nil {
+			action, err = applyLDIFRecord(config, record, dn, mode)
+		}
+		if err != nil {
+			if dn == "" {
+				dn = record.DN
+			}
+			report = append(report, fmt.Sprintf("error %s: %v", dn, err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		report = append(report, fmt.Sprintf("%s %s", action, dn))
+	}
+	return report, firstErr
+}
+
+// checkLDIFRecord validates the contact record leaves at dn, normalizing
+// the phone numbers the record writes.
+func checkLDIFRecord(config Config, record *LDIFRecord, dn string) error {
+	var attrs []ldap.Attribute
+	switch record.ChangeType {
+	case "delete":
+		return nil
+	case "modify":
+		current, err := ldifEntry(config, dn)
+		if err != nil {
+			return err
+		}
+		attrs = applyLDIFChanges(current.Attributes, record.Changes)
+	default:
+		attrs = record.Attributes
+	}
+
+	values := map[string][]string{}
+	for _, attr := range attrs {
+		values[attr.Type] = attr.Vals
+	}
+	c := fromEntry(ldap.NewEntry(dn, values))
+	region := c.region(config.DefaultRegion)
+	c.Phone = normalizePhones(c.Phone, region)
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	for i := range record.Attributes {
+		if strings.EqualFold(record.Attributes[i].Type, "telephoneNumber") {
+			record.Attributes[i].Vals = normalizePhones(record.Attributes[i].Vals, region)
+		}
+	}
+	for i, change := range record.Changes {
+		if change.Operation != ldap.DeleteAttribute && strings.EqualFold(change.Modification.Type, "telephoneNumber") {
+			record.Changes[i].Modification.Vals = normalizePhones(change.Modification.Vals, region)
+		}
+	}
+	return nil
+}
+
+// ldifEntry returns the entry at dn as it is before a modify record is
+// applied to it.
+func ldifEntry(config Config, dn string) (*ldap.Entry, error) {
+	request := buildSearchRequest(config.BaseDN, nil)
+	request.BaseDN = dn
+	request.Scope = ldap.ScopeBaseObject
+	var found *ldap.Entry
+	err := getEntries(config, request, func(e *ldap.Entry) { found = e })
+	switch {
+	case hasResultCode(err, ldap.LDAPResultNoSuchObject), err == nil && found == nil:
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+	return found, nil
+}
+
+// applyLDIFChanges returns the attributes that result from making changes
+// to entry attributes.
+func applyLDIFChanges(current []*ldap.EntryAttribute, changes []ldap.Change) []ldap.Attribute {
+	var attrs []ldap.Attribute
+	for _, attr := range current {
+		attrs = append(attrs, ldap.Attribute{Type: attr.Name, Vals: attr.Values})
+	}
+	for _, change := range changes {
+		mod := change.Modification
+		i := 0
+		for i < len(attrs) && !strings.EqualFold(attrs[i].Type, mod.Type) {
+			i++
+		}
+		if i == len(attrs) {
+			attrs = append(attrs, ldap.Attribute{Type: mod.Type})
+		}
+		switch change.Operation {
+		case ldap.AddAttribute:
+			attrs[i].Vals = append(append([]string(nil), attrs[i].Vals...), mod.Vals...)
+		case ldap.ReplaceAttribute:
+			attrs[i].Vals = mod.Vals
+		case ldap.DeleteAttribute:
+			if len(mod.Vals) == 0 {
+				attrs[i].Vals = nil
+				continue
+			}
+			deleted := map[string]bool{}
+			for _, v := range mod.Vals {
+				deleted[v] = true
+			}
+			var kept []string
+			for _, v := range attrs[i].Vals {
+				if !deleted[v] {
+					kept = append(kept, v)
+				}
+			}
+			attrs[i].Vals = kept
+		}
+	}
+	return attrs
+}
+
+func applyLDIFRecord(config Config, record *LDIFRecord, dn, mode string) (string, error) {
+	switch record.ChangeType {
+	case "delete":
+		return "deleted", del(config, buildDeleteRequest(dn))
+	case "modify":
+		req := ldap.NewModifyRequest(dn, nil)
+		req.Changes = record.Changes
+		return "modified", save(config, req)
+	case "add":
+		return "added", create(config, &ldap.AddRequest{DN: dn, Attributes: record.Attributes})
+	}
+
+	add := &ldap.AddRequest{DN: dn, Attributes: record.Attributes}
+	if mode != LDIFModify {
+		return "added", create(config, add)
+	}
+	req := ldap.NewModifyRequest(dn, nil)
+	for _, attr := range record.Attributes {
+		if !strings.EqualFold(attr.Type, "objectClass") {
+			req.Replace(attr.Type, attr.Vals)
+		}
+	}
+	err := save(config, req)
+	if hasResultCode(err, ldap.LDAPResultNoSuchObject) {
+		return "added", create(config, add)
+	}
+	return "modified", err
+}
+
+func parseLDIFRecord(lines []string) (*LDIFRecord, error) {
+	var (
+		record *LDIFRecord
+		change *ldap.Change
+	)
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "-" {
+			if change != nil {
+				record.Changes = append(record.Changes, *change)
+				change = nil
+			}
+			continue
+		}
+		name, value, err := parseLDIFLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case record == nil && strings.EqualFold(name, "version"):
+			// A version line may precede the first record.
+		case record == nil && strings.EqualFold(name, "dn"):
+			record = &LDIFRecord{DN: value}
+		case record == nil:
+			return nil, fmt.Errorf("expected dn, found %q", name)
+		case strings.EqualFold(name, "changetype") && record.ChangeType == "" && len(record.Attributes) == 0:
+			record.ChangeType = strings.ToLower(value)
+			if record.ChangeType != "add" && record.ChangeType != "modify" && record.ChangeType != "delete" {
+				return nil, fmt.Errorf("unsupported changetype %q", value)
+			}
+		case record.ChangeType == "modify" && change == nil:
+			op, ok := map[string]uint{
+				"add":     ldap.AddAttribute,
+				"delete":  ldap.DeleteAttribute,
+				"replace": ldap.ReplaceAttribute,
+			}[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported modify operation %q", name)
+			}
+			change = &ldap.Change{Operation: op, Modification: ldap.PartialAttribute{Type: value}}
+		case record.ChangeType == "modify":
+			change.Modification.Vals = append(change.Modification.Vals, value)
+		default:
+			record.Attributes = appendAttribute(record.Attributes, name, value)
+		}
+	}
+	if change != nil {
+		record.Changes = append(record.Changes, *change)
+	}
+	return record, nil
+}
+
+func parseLDIFLine(line string) (string, string, error) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", "", fmt.Errorf("missing ':' in %q", line)
+	}
+	name, value := line[:colon], line[colon+1:]
+	switch {
+	case strings.HasPrefix(value, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %v", name, err)
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(value, "<"):
+		return "", "", fmt.Errorf("%s: URL values are not supported", name)
+	default:
+		return name, strings.TrimLeft(value, " "), nil
+	}
+}
+
+func appendAttribute(attrs []ldap.Attribute, name, value string) []ldap.Attribute {
+	for i := range attrs {
+		if strings.EqualFold(attrs[i].Type, name) {
+			attrs[i].Vals = append(attrs[i].Vals, value)
+			return attrs
+		}
+	}
+	return append(attrs, ldap.Attribute{Type: name, Vals: []string{value}})
+}
+
+// ldifLine formats an attribute value, base64 encoding values that are not
+// safe strings and folding long lines.
+func ldifLine(name, value string) string {
+	line := name + ": " + value
+	if !isSafeLDIFString(value) {
+		line = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	var b strings.Builder
+	for len(line) > ldifLineLength {
+		b.WriteString(line[:ldifLineLength])
+		b.WriteString("\n ")
+		line = line[ldifLineLength:]
+	}
+	b.WriteString(line)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// isSafeLDIFString reports whether value is a SAFE-STRING as defined by
+// RFC 2849.
+func isSafeLDIFString(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.ContainsAny(value[:1], " :<") || strings.HasSuffix(value, " ") {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// rebaseDN moves dn under the ou=contacts container of baseDN, keeping the
+// RDNs below the container it was exported from. DNs outside of any
+// ou=contacts container are an error.
+func rebaseDN(dn, baseDN string) (string, error) {
+	rdns := splitDN(dn)
+	for i, rdn := range rdns {
+		if strings.EqualFold(strings.Replace(rdn, " ", "", -1), "ou=contacts") {
+			return strings.Join(append(rdns[:i], "ou=contacts", baseDN), ","), nil
+		}
+	}
+	return "", fmt.Errorf("%q is not in an ou=contacts container", dn)
+}
+
+// splitDN splits dn into its RDNs, respecting escaped commas.
+func splitDN(dn string) []string {
+	var (
+		rdns  []string
+		start int
+	)
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',':
+			rdns = append(rdns, strings.TrimSpace(dn[start:i]))
+			start = i + 1
+		}
+	}
+	return append(rdns, strings.TrimSpace(dn[start:]))
+}
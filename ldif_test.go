@@ -0,0 +1,142 @@
+package contacts
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestLDIFRoundTrip(t *testing.T) {
+	entries := []*ldap.Entry{
+		ldap.NewEntry("cn=Jürgen Müller,ou=contacts,dc=old,dc=org", map[string][]string{
+			"objectClass": {"contact", "inetOrgPerson"},
+			"cn":          {"Jürgen Müller"},
+			"description": {strings.Repeat("long ", 30)},
+			"mail":        {"j@example.org", "jm@example.org"},
+		}),
+	}
+	var b bytes.Buffer
+	if err := WriteLDIF(&b, entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(b.String(), "\n") {
+		if len(line) > ldifLineLength+1 {
+			t.Errorf("line not folded: %q", line)
+		}
+	}
+	if !strings.Contains(b.String(), "dn:: ") {
+		t.Errorf("expected non-ASCII dn to be base64 encoded:\n%s", b.String())
+	}
+
+	records, err := ReadLDIF(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].DN != entries[0].DN {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	for _, attr := range records[0].Attributes {
+		if expected := entries[0].GetAttributeValues(attr.Type); strings.Join(expected, "|") != strings.Join(attr.Vals, "|") {
+			t.Errorf("%s: expected %q, got %q", attr.Type, expected, attr.Vals)
+		}
+	}
+}
+
+func TestReadLDIFChangeRecords(t *testing.T) {
+	data := "version: 1\n\n" +
+		"# a comment\n" +
+		"dn: cn=Jane,ou=contacts,dc=old,dc=org\n" +
+		"changetype: modify\n" +
+		"replace: mail\n" +
+		"mail: jane@example.org\n" +
+		"-\n" +
+		"delete: telephoneNumber\n" +
+		"-\n\n" +
+		"dn: cn=John,ou=contacts,dc=old,dc=org\n" +
+		"changetype: delete\n"
+	records, err := ReadLDIF(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	changes := records[0].Changes
+	if len(changes) != 2 || changes[0].Operation != ldap.ReplaceAttribute || changes[0].Modification.Vals[0] != "jane@example.org" {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if changes[1].Operation != ldap.DeleteAttribute || changes[1].Modification.Type != "telephoneNumber" {
+		t.Errorf("unexpected delete: %+v", changes[1])
+	}
+	if records[1].ChangeType != "delete" {
+		t.Errorf("unexpected record: %+v", records[1])
+	}
+}
+
+func TestRebaseDN(t *testing.T) {
+	cases := map[string]string{
+		"cn=Jane,ou=contacts,dc=old,dc=org":       "cn=Jane,ou=contacts,dc=new,dc=net",
+		`cn=Doe\, Jane,ou=contacts,dc=old,dc=org`: `cn=Doe\, Jane,ou=contacts,dc=new,dc=net`,
+	}
+	for dn, expected := range cases {
+		if got, err := rebaseDN(dn, "dc=new,dc=net"); got != expected || err != nil {
+			t.Errorf("rebaseDN(%q) = %q, %v; expected %q", dn, got, err, expected)
+		}
+	}
+	if got, err := rebaseDN("cn=Jane,ou=people,dc=old,dc=org", "dc=new,dc=net"); err == nil {
+		t.Errorf("rebaseDN outside ou=contacts = %q; expected an error", got)
+	}
+}
+
+func TestCheckLDIFRecord(t *testing.T) {
+	config := Config{DefaultRegion: "US"}
+	record := &LDIFRecord{DN: "cn=Jane,ou=contacts,dc=example", Attributes: []ldap.Attribute{
+		{Type: "cn", Vals: []string{"Jane"}},
+		{Type: "telephoneNumber", Vals: []string{"(555) 123-4567"}},
+	}}
+	if err := checkLDIFRecord(config, record, record.DN); err != nil {
+		t.Fatal(err)
+	}
+	if got := record.Attributes[1].Vals; len(got) != 1 || got[0] != "+15551234567" {
+		t.Errorf("phone not normalized: %v", got)
+	}
+
+	record.Attributes = append(record.Attributes, ldap.Attribute{Type: "mail", Vals: []string{"not an address"}})
+	var errs ValidationErrors
+	if err := checkLDIFRecord(config, record, record.DN); !errors.As(err, &errs) || errs["Email"] == "" {
+		t.Errorf("invalid email accepted: %v", err)
+	}
+	if err := checkLDIFRecord(config, &LDIFRecord{DN: record.DN, ChangeType: "delete"}, record.DN); err != nil {
+		t.Errorf("delete: %v", err)
+	}
+}
+
+func TestApplyLDIFChanges(t *testing.T) {
+	current := []*ldap.EntryAttribute{
+		{Name: "cn", Values: []string{"Jane"}},
+		{Name: "mail", Values: []string{"jane@example.com", "old@example.com"}},
+		{Name: "telephoneNumber", Values: []string{"+15551234567"}},
+	}
+	attrs := applyLDIFChanges(current, []ldap.Change{
+		{Operation: ldap.DeleteAttribute, Modification: ldap.PartialAttribute{Type: "mail", Vals: []string{"old@example.com"}}},
+		{Operation: ldap.DeleteAttribute, Modification: ldap.PartialAttribute{Type: "telephoneNumber"}},
+		{Operation: ldap.AddAttribute, Modification: ldap.PartialAttribute{Type: "displayName", Vals: []string{"Jane Doe"}}},
+		{Operation: ldap.ReplaceAttribute, Modification: ldap.PartialAttribute{Type: "CN", Vals: []string{"Jane D"}}},
+	})
+	got := map[string]string{}
+	for _, attr := range attrs {
+		got[attr.Type] = strings.Join(attr.Vals, ",")
+	}
+	want := map[string]string{"cn": "Jane D", "mail": "jane@example.com", "telephoneNumber": "", "displayName": "Jane Doe"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q; expected %q", k, got[k], v)
+		}
+	}
+	if current[1].Values[1] != "old@example.com" {
+		t.Error("current entry changed")
+	}
+}
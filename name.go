@@ -0,0 +1,131 @@
+package contacts
+
+import (
+	"strings"
+)
+
+// Name is a personal name broken into its parts.
+type Name struct {
+	Prefix string
+	First  string
+	Middle string
+	Last   string
+	Suffix string
+}
+
+var (
+	honorifics = map[string]bool{
+		"capt": true, "col": true, "dame": true, "dr": true, "fr": true,
+		"gen": true, "hon": true, "lady": true, "lord": true, "lt": true,
+		"miss": true, "mr": true, "mrs": true, "ms": true, "mx": true,
+		"prof": true, "rev": true, "sgt": true, "sir": true,
+	}
+	generationSuffixes = map[string]bool{
+		"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "v": true,
+		"esq": true, "md": true, "phd": true, "dds": true, "cpa": true,
+	}
+	surnameParticles = map[string]bool{
+		"al": true, "bin": true, "da": true, "das": true, "de": true,
+		"dei": true, "del": true, "della": true, "der": true, "di": true,
+		"do": true, "dos": true, "du": true, "el": true, "la": true,
+		"le": true, "st": true, "st.": true, "ten": true, "ter": true,
+		"van": true, "von": true, "zu": true,
+	}
+)
+
+// ParseName splits a free-form name such as "Dr. Jane Q. van der Berg Jr."
+// or "van der Berg, Jane Q." into its parts.
+func ParseName(full string) Name {
+	full = strings.TrimSpace(full)
+
+	// "Last, First Middle" and "First Last, Jr." forms.
+	if parts := strings.SplitN(full, ",", 2); len(parts) == 2 {
+		head, rest := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if isSuffixes(rest) {
+			n := ParseName(head)
+			n.Suffix = joinNonEmpty(" ", n.Suffix, rest)
+			return n
+		}
+		n, tokens := splitAffixes(strings.Fields(rest))
+		if len(tokens) > 0 {
+			n.First = tokens[0]
+			n.Middle = strings.Join(tokens[1:], " ")
+		}
+		n.Last = head
+		return n
+	}
+
+	n, tokens := splitAffixes(strings.Fields(full))
+	switch len(tokens) {
+	case 0:
+	case 1:
+		n.First = tokens[0]
+	default:
+		n.First = tokens[0]
+		last := len(tokens) - 1
+		for i := 1; i < len(tokens)-1; i++ {
+			if isParticle(tokens[i]) {
+				last = i
+				break
+			}
+		}
+		n.Middle = strings.Join(tokens[1:last], " ")
+		n.Last = strings.Join(tokens[last:], " ")
+	}
+	return n
+}
+
+// splitAffixes removes leading honorifics and trailing suffixes from tokens,
+// returning them in a Name along with the remaining tokens.
+func splitAffixes(tokens []string) (Name, []string) {
+	var n Name
+	for len(tokens) > 1 && isHonorific(tokens[0]) {
+		n.Prefix = joinNonEmpty(" ", n.Prefix, tokens[0])
+		tokens = tokens[1:]
+	}
+	var suffixes []string
+	for len(tokens) > 1 && isSuffix(tokens[len(tokens)-1]) {
+		suffixes = append([]string{tokens[len(tokens)-1]}, suffixes...)
+		tokens = tokens[:len(tokens)-1]
+	}
+	n.Suffix = strings.Join(suffixes, " ")
+	return n, tokens
+}
+
+// String joins the parts of the name in display order.
+func (n Name) String() string {
+	return joinNonEmpty(" ", n.Prefix, n.First, n.Middle, n.Last, n.Suffix)
+}
+
+// lastNameSortKey returns the part of a surname used for sorting. Leading
+// lower case particles, as in "van der Berg", are skipped so the name sorts
+// under "Berg". Capitalised particles, as in "Van Buren", are kept.
+func lastNameSortKey(last string) string {
+	tokens := strings.Fields(last)
+	for len(tokens) > 1 && isParticle(tokens[0]) && strings.ToLower(tokens[0]) == tokens[0] {
+		tokens = tokens[1:]
+	}
+	return strings.Join(tokens, " ")
+}
+
+func isHonorific(token string) bool {
+	return honorifics[strings.ToLower(strings.TrimSuffix(token, "."))]
+}
+
+func isSuffix(token string) bool {
+	return generationSuffixes[strings.ToLower(strings.Replace(strings.TrimSpace(token), ".", "", -1))]
+}
+
+func isSuffixes(text string) bool {
+	tokens := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' })
+	for _, token := range tokens {
+		if !isSuffix(token) {
+			return false
+		}
+	}
+	return len(tokens) > 0
+}
+
+func isParticle(token string) bool {
+	return surnameParticles[strings.ToLower(token)]
+}
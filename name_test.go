@@ -0,0 +1,60 @@
+package contacts
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+)
+
+func TestParseName(t *testing.T) {
+	cases := []struct {
+		full     string
+		expected Name
+	}{
+		{"Jane Doe", Name{First: "Jane", Last: "Doe"}},
+		{"Cher", Name{First: "Cher"}},
+		{"Dr. Jane Q. van der Berg Jr.", Name{Prefix: "Dr.", First: "Jane", Middle: "Q.", Last: "van der Berg", Suffix: "Jr."}},
+		{"Mr John Ronald Reuel Tolkien", Name{Prefix: "Mr", First: "John", Middle: "Ronald Reuel", Last: "Tolkien"}},
+		{"Martin Luther King, Jr.", Name{First: "Martin", Middle: "Luther", Last: "King", Suffix: "Jr."}},
+		{"van der Berg, Jane Q.", Name{First: "Jane", Middle: "Q.", Last: "van der Berg"}},
+		{"Ludwig van Beethoven", Name{First: "Ludwig", Last: "van Beethoven"}},
+		{"Henry Ford III", Name{First: "Henry", Last: "Ford", Suffix: "III"}},
+		{"", Name{}},
+	}
+	for _, c := range cases {
+		if got := ParseName(c.full); got != c.expected {
+			t.Errorf("ParseName(%q) = %+v; expected %+v", c.full, got, c.expected)
+		}
+	}
+}
+
+func TestByLastNameParticles(t *testing.T) {
+	list := []*Contact{
+		{First: "Jane", Last: "van der Berg"},
+		{First: "Martin", Last: "Van Buren"},
+		{First: "Ann", Last: "Adams"},
+		{First: "Carl", Last: "Carter"},
+	}
+	sort.Sort(ByLastName(list))
+	var got []string
+	for _, c := range list {
+		got = append(got, c.Last)
+	}
+	expected := []string{"Adams", "van der Berg", "Carter", "Van Buren"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("unexpected order %q; expected %q", got, expected)
+		}
+	}
+}
+
+func TestContactFromFormNames(t *testing.T) {
+	created := contactFromForm(url.Values{"displayName": {"Dr. Jane Q. van der Berg"}}, nil)
+	if created.First != "Jane" || created.Middle != "Q." || created.Last != "van der Berg" {
+		t.Errorf("new contact name not parsed: %+v", created)
+	}
+	edited := contactFromForm(url.Values{"dn": {"cn=Cher,ou=contacts,dc=example"}, "displayName": {"Cher"}}, nil)
+	if edited.First != "" || edited.Last != "" {
+		t.Errorf("existing contact name parsed: %+v", edited)
+	}
+}
@@ -0,0 +1,149 @@
+package contacts
+
+import (
+	"net/http"
+	"strings"
+)
+
+// openAPIDocument describes the JSON API served by handleAPI. The server
+// URL placeholder is replaced with the API route when it is served.
+const openAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Contacts API",
+    "version": "v1",
+    "description": "Read and manage the contacts kept in the directory. Contact IDs are stable UUIDs and do not reveal directory DNs."
+  },
+  "servers": [{"url": "{{API_ROOT}}"}],
+  "security": [{"basic": []}],
+  "paths": {
+    "/contacts": {
+      "get": {
+        "operationId": "listContacts",
+        "summary": "List contacts",
+        "parameters": [
+          {"name": "label", "in": "query", "description": "Only contacts with every given label.", "schema": {"type": "array", "items": {"type": "string"}}, "style": "form", "explode": true},
+          {"name": "q", "in": "query", "description": "Case insensitive match on names, nicknames and email addresses.", "schema": {"type": "string"}},
+          {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["", "last", "phonetic", "phonetic-last"]}}
+        ],
+        "responses": {
+          "200": {"description": "Matching contacts.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Contact"}}}}},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "createContact",
+        "summary": "Create a contact",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Contact"}}}},
+        "responses": {
+          "201": {"description": "The created contact.", "headers": {"Location": {"schema": {"type": "string"}}}, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Contact"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/contacts/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}}],
+      "get": {
+        "operationId": "getContact",
+        "summary": "Get a contact",
+        "responses": {
+          "200": {"description": "The contact.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Contact"}}}},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "patch": {
+        "operationId": "updateContact",
+        "summary": "Update the fields present in the body",
+        "description": "Fields missing from the body are left unchanged; send an empty string or array to clear a field.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Contact"}}}},
+        "responses": {
+          "200": {"description": "The updated contact.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Contact"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "operationId": "deleteContact",
+        "summary": "Delete a contact",
+        "responses": {
+          "204": {"description": "Deleted."},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/labels": {
+      "get": {
+        "operationId": "listLabels",
+        "summary": "List labels with the number of contacts having each",
+        "responses": {
+          "200": {"description": "Labels.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Label"}}}}},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "basic": {"type": "http", "scheme": "basic", "description": "Directory credentials, when the server requires signing in. Reading needs the viewer role, creating and updating the editor role and deleting the admin role."}
+    },
+    "responses": {
+      "Error": {"description": "An error.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Contact": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string", "format": "uuid", "readOnly": true},
+          "name": {"type": "string", "description": "Display name."},
+          "prefix": {"type": "string"},
+          "first": {"type": "string"},
+          "middle": {"type": "string"},
+          "last": {"type": "string"},
+          "suffix": {"type": "string"},
+          "nickname": {"type": "array", "items": {"type": "string"}},
+          "phoneticFirst": {"type": "string"},
+          "phoneticLast": {"type": "string"},
+          "email": {"type": "array", "items": {"type": "string", "format": "email"}},
+          "phone": {"type": "array", "items": {"type": "string"}},
+          "street": {"type": "array", "items": {"type": "string"}},
+          "city": {"type": "string"},
+          "state": {"type": "string"},
+          "zip": {"type": "string"},
+          "country": {"type": "string", "description": "ISO country code."},
+          "birthday": {"type": "string", "description": "2006-01-02, or --01-02 when the year is unknown."},
+          "labels": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "Label": {
+        "type": "object",
+        "required": ["label", "count"],
+        "properties": {
+          "label": {"type": "string"},
+          "count": {"type": "integer"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {
+          "error": {"type": "string"},
+          "fields": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Messages for invalid fields, by field name."}
+        }
+      }
+    }
+  }
+}
+`
+
+func (s *server) apiDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if _, err := w.Write([]byte(strings.Replace(openAPIDocument, "{{API_ROOT}}", s.apiRoute(), 1))); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,209 @@
+package contacts
+
+import (
+	"strings"
+)
+
+// callingCode describes how numbers are dialled in a region.
+type callingCode struct {
+	Code  string // international calling code, without the leading +
+	Trunk string // national trunk prefix, stripped from national numbers
+}
+
+var (
+	callingCodes = map[string]callingCode{
+		"US": {"1", "1"},
+		"CA": {"1", "1"},
+		"MX": {"52", ""},
+		"GB": {"44", "0"},
+		"UK": {"44", "0"},
+		"IE": {"353", "0"},
+		"DE": {"49", "0"},
+		"AT": {"43", "0"},
+		"CH": {"41", "0"},
+		"FR": {"33", "0"},
+		"BE": {"32", "0"},
+		"NL": {"31", "0"},
+		"IT": {"39", ""},
+		"ES": {"34", ""},
+		"PT": {"351", ""},
+		"SE": {"46", "0"},
+		"NO": {"47", ""},
+		"DK": {"45", ""},
+		"FI": {"358", "0"},
+		"PL": {"48", ""},
+		"JP": {"81", "0"},
+		"CN": {"86", "0"},
+		"KR": {"82", "0"},
+		"IN": {"91", "0"},
+		"AU": {"61", "0"},
+		"NZ": {"64", "0"},
+		"BR": {"55", "0"},
+		"AR": {"54", "0"},
+		"ZA": {"27", "0"},
+		"PH": {"63", "0"},
+	}
+)
+
+// NormalizePhone converts number to E.164 form (+15551234567), using region
+// (an ISO country code such as "US") to interpret numbers written without an
+// international prefix. The second return value is false, and number is
+// returned unchanged, when it cannot be interpreted.
+func NormalizePhone(number, region string) (string, bool) {
+	trimmed := strings.TrimSpace(number)
+	if trimmed == "" || strings.ContainsAny(strings.ToLower(trimmed), "x#,;") {
+		return number, false
+	}
+	// "(0)" marks a trunk prefix only dialled from within the country, as
+	// in +44 (0) 20 7946 0958.
+	trimmed = strings.Replace(trimmed, "(0)", "", 1)
+	var digits strings.Builder
+	for i, r := range trimmed {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case strings.ContainsRune("-.() /", r):
+		default:
+			return number, false
+		}
+	}
+	d := digits.String()
+	cc, known := callingCodes[strings.ToUpper(strings.TrimSpace(region))]
+
+	switch {
+	case strings.HasPrefix(trimmed, "+"):
+	case known && cc.Code == "1" && strings.HasPrefix(d, "011"):
+		d = strings.TrimPrefix(d, "011")
+	case known && cc.Code != "1" && strings.HasPrefix(d, "00"):
+		d = strings.TrimPrefix(d, "00")
+	case !known:
+		return number, false
+	case cc.Code == "1":
+		switch {
+		case len(d) == 10:
+			d = "1" + d
+		case len(d) == 11 && strings.HasPrefix(d, "1"):
+		default:
+			return number, false
+		}
+	default:
+		d = cc.Code + strings.TrimPrefix(d, cc.Trunk)
+	}
+
+	if len(d) < 8 || len(d) > 15 || d[0] == '0' {
+		return number, false
+	}
+	return "+" + d, true
+}
+
+// FormatPhone formats an E.164 number for display. Numbers belonging to
+// region are shown in national form, all others in international form.
+// Numbers that are not in E.164 form are returned unchanged.
+func FormatPhone(number, region string) string {
+	code, national, ok := splitE164(number)
+	if !ok {
+		return number
+	}
+	cc, known := callingCodes[strings.ToUpper(strings.TrimSpace(region))]
+	if known && cc.Code == code {
+		if code == "1" && len(national) == 10 {
+			return "(" + national[:3] + ") " + national[3:6] + "-" + national[6:]
+		}
+		return cc.Trunk + groupDigits(code, national)
+	}
+	if code == "1" && len(national) == 10 {
+		return "+1 " + national[:3] + "-" + national[3:6] + "-" + national[6:]
+	}
+	return "+" + code + " " + groupDigits(code, national)
+}
+
+// splitE164 splits an E.164 number into its calling code and national
+// significant number.
+func splitE164(number string) (code, national string, ok bool) {
+	if !strings.HasPrefix(number, "+") || len(number) < 9 {
+		return "", "", false
+	}
+	digits := number[1:]
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", "", false
+		}
+	}
+	for n := 1; n <= 3; n++ {
+		for _, cc := range callingCodes {
+			if cc.Code == digits[:n] {
+				return digits[:n], digits[n:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// nationalGroups gives, by calling code, the sizes of the groups national
+// numbers are written in. Numbering plans without rules here, most of which
+// have area codes of varying length, are shown ungrouped.
+var nationalGroups = map[string]func(national string) []int{
+	"33": func(national string) []int {
+		if len(national) == 9 {
+			return []int{1, 2, 2, 2, 2}
+		}
+		return nil
+	},
+	"44": func(national string) []int {
+		if len(national) != 10 {
+			return nil
+		}
+		switch {
+		case national[0] == '2':
+			return []int{2, 4, 4} // 020 7946 0958
+		case national[0] == '1' && (national[1] == '1' || national[2] == '1'):
+			return []int{3, 3, 4} // 0113 496 0000, 0121 496 0000
+		case national[0] == '1', national[0] == '7':
+			return []int{4, 6} // 01632 960000, 07700 900000
+		case strings.IndexByte("389", national[0]) >= 0:
+			return []int{3, 3, 4} // 0300 123 4567
+		}
+		return nil
+	},
+}
+
+// groupDigits separates the national number of a calling code into the
+// groups it is written in, leaving it ungrouped when they are not known.
+func groupDigits(code, national string) string {
+	rule := nationalGroups[code]
+	if rule == nil {
+		return national
+	}
+	sizes := rule(national)
+	if sizes == nil {
+		return national
+	}
+	groups := make([]string, len(sizes))
+	for i, size := range sizes {
+		groups[i], national = national[:size], national[size:]
+	}
+	return strings.Join(groups, " ")
+}
+
+// normalizePhones normalizes each number, keeping the original text of any
+// that cannot be parsed, and removes resulting duplicates.
+func normalizePhones(numbers []string, region string) []string {
+	if len(numbers) == 0 {
+		return numbers
+	}
+	normalized := make([]string, len(numbers))
+	for i, number := range numbers {
+		normalized[i], _ = NormalizePhone(number, region)
+	}
+	return dedupe(normalized)
+}
+
+// region is the country used to interpret and display the contact's phone
+// numbers and address.
+func (c *Contact) region(defaultRegion string) string {
+	if c != nil && c.Country != "" {
+		return c.Country
+	}
+	return defaultRegion
+}
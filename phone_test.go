@@ -0,0 +1,60 @@
+package contacts
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		number, region, expected string
+		ok                       bool
+	}{
+		{"(555) 123-4567", "US", "+15551234567", true},
+		{"555.123.4567", "us", "+15551234567", true},
+		{"1-555-123-4567", "CA", "+15551234567", true},
+		{"+15551234567", "", "+15551234567", true},
+		{"+44 20 7946 0958", "US", "+442079460958", true},
+		{"+44 (0) 20 7946 0958", "US", "+442079460958", true},
+		{"0049 (0)30 123456", "GB", "+4930123456", true},
+		{"020 7946 0958", "UK", "+442079460958", true},
+		{"0044 20 7946 0958", "DE", "+442079460958", true},
+		{"030 123456", "DE", "+4930123456", true},
+		{"555 1234", "US", "555 1234", false},
+		{"555-123-4567", "", "555-123-4567", false},
+		{"555-123-4567 x12", "US", "555-123-4567 x12", false},
+		{"call me", "US", "call me", false},
+	}
+	for _, c := range cases {
+		got, ok := NormalizePhone(c.number, c.region)
+		if got != c.expected || ok != c.ok {
+			t.Errorf("NormalizePhone(%q, %q) = %q, %t; expected %q, %t", c.number, c.region, got, ok, c.expected, c.ok)
+		}
+	}
+}
+
+func TestFormatPhone(t *testing.T) {
+	cases := []struct {
+		number, region, expected string
+	}{
+		{"+15551234567", "US", "(555) 123-4567"},
+		{"+15551234567", "DE", "+1 555-123-4567"},
+		{"+442079460958", "GB", "020 7946 0958"},
+		{"+442079460958", "US", "+44 20 7946 0958"},
+		{"+447700900123", "GB", "07700 900123"},
+		{"+441134960000", "GB", "0113 496 0000"},
+		{"+33123456789", "FR", "01 23 45 67 89"},
+		{"+4930123456", "DE", "030123456"},
+		{"+4930123456", "US", "+49 30123456"},
+		{"555-1234", "US", "555-1234"},
+	}
+	for _, c := range cases {
+		if got := FormatPhone(c.number, c.region); got != c.expected {
+			t.Errorf("FormatPhone(%q, %q) = %q; expected %q", c.number, c.region, got, c.expected)
+		}
+	}
+}
+
+func TestNormalizePhonesDedupe(t *testing.T) {
+	got := normalizePhones([]string{"(555) 123-4567", "555.123.4567", "+15551234567"}, "US")
+	if len(got) != 1 || got[0] != "+15551234567" {
+		t.Errorf("expected a single normalized number: %v", got)
+	}
+}
@@ -13,6 +13,55 @@
                 }
             });
         }
+        watchChanges(document.body.dataset.events);
     });
+
+    // watchChanges highlights the rows of contacts that change while the
+    // page is open and offers to reload it.
+    function watchChanges(url) {
+        if (!url || !window.EventSource) {
+            return;
+        }
+        const source = new EventSource(url);
+        ['create', 'update', 'delete'].forEach(function (type) {
+            source.addEventListener(type, function (e) {
+                changed(type, JSON.parse(e.data));
+            });
+        });
+    }
+
+    function changed(type, change) {
+        const rows = document.querySelectorAll('[data-contact="' + change.id + '"]');
+        rows.forEach(function (row) {
+            row.classList.remove('changed');
+            void row.offsetWidth; // restart the highlight
+            row.classList.add(type === 'delete' ? 'deleted' : 'changed');
+        });
+        const listed = document.querySelector('table.contacts, table.birthdays');
+        if (rows.length || (type === 'create' && listed)) {
+            notify(change.name + ' was ' + type + 'd');
+        }
+    }
+
+    function notify(message) {
+        let notice = document.getElementById('stale');
+        if (!notice) {
+            notice = document.createElement('p');
+            notice.id = 'stale';
+            notice.className = 'stale';
+            notice.appendChild(document.createElement('span'));
+            let reload = document.createElement('a');
+            reload.href = '';
+            reload.textContent = 'Reload';
+            reload.addEventListener('click', function (e) {
+                e.preventDefault();
+                window.location.reload();
+            });
+            notice.appendChild(document.createTextNode(' '));
+            notice.appendChild(reload);
+            document.body.insertBefore(notice, document.body.firstChild);
+        }
+        notice.firstChild.textContent = message + '.';
+    }
     console.info('loaded...');
 })()
@@ -0,0 +1,250 @@
+package contacts
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultDigestTemplate renders the reminder digest. Templates define a
+// "subject" template and a body, and are executed with a Digest.
+const DefaultDigestTemplate = `{{ define "subject" }}Upcoming birthdays{{ with .Reminder.Labels }} ({{ join . ", " }}){{ end }}{{ end -}}
+Birthdays in the next {{ .Reminder.LeadDays }} days:
+{{ range .Birthdays }}
+  {{ .Date.Format "Mon Jan _2" }}  {{ .Contact.DisplayName }}{{ with .Age }} turns {{ . }}{{ end }}{{ if eq .Days 0 }} (today){{ else if eq .Days 1 }} (tomorrow){{ end }}
+{{- end }}
+`
+
+// SMTPConfig describes the mail server reminders are sent through.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// StartTLS requires the server to offer STARTTLS. Without it, STARTTLS
+	// is still used whenever the server offers it.
+	StartTLS bool
+	// TLSConfig overrides the TLS settings used for STARTTLS.
+	TLSConfig *tls.Config
+}
+
+// Reminder is a digest of upcoming birthdays sent to a list of recipients.
+type Reminder struct {
+	// Labels limits the digest to contacts with all of the labels.
+	Labels   []string
+	To       []string
+	LeadDays int
+}
+
+// ParseReminder parses "labels:recipients:days", where labels and
+// recipients are comma separated and labels may be empty for every
+// contact, e.g. "family:alice@example.com,bob@example.com:14".
+func ParseReminder(spec string) (Reminder, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return Reminder{}, fmt.Errorf("reminder %q is not labels:recipients:days", spec)
+	}
+	days, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+	if err != nil || days < 0 {
+		return Reminder{}, fmt.Errorf("reminder %q: invalid number of days %q", spec, parts[2])
+	}
+	r := Reminder{Labels: splitList(parts[0]), To: splitList(parts[1]), LeadDays: days}
+	if len(r.To) == 0 {
+		return Reminder{}, fmt.Errorf("reminder %q has no recipients", spec)
+	}
+	return r, nil
+}
+
+// UpcomingBirthday is a birthday falling within a reminder's lead time.
+type UpcomingBirthday struct {
+	Contact *Contact
+	Date    time.Time
+	// Age is the age reached on Date, if the year of birth is known.
+	Age string
+	// Days is the number of days from the digest date until Date.
+	Days int
+}
+
+// Digest is the data the digest template is executed with.
+type Digest struct {
+	Reminder  Reminder
+	Date      time.Time
+	Birthdays []UpcomingBirthday
+}
+
+// UpcomingBirthdays returns the birthdays of records from the day of from
+// through the following days, in order.
+func UpcomingBirthdays(records []*Contact, from time.Time, days int) []UpcomingBirthday {
+	sorted := make([]*Contact, len(records))
+	copy(sorted, records)
+	sort.Sort(ByBirthday(sorted))
+
+	today := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	var upcoming []UpcomingBirthday
+	for _, contact := range sorted {
+		if contact.Birthday.IsZero() {
+			continue
+		}
+		date := occurrenceIn(contact.Birthday, today.Year())
+		if date.Before(today) {
+			date = occurrenceIn(contact.Birthday, today.Year()+1)
+		}
+		away := int(date.Sub(today).Hours() / 24)
+		if away > days {
+			continue
+		}
+		upcoming = append(upcoming, UpcomingBirthday{
+			Contact: contact,
+			Date:    date,
+			Age:     contact.AgeOn(date),
+			Days:    away,
+		})
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool { return upcoming[i].Days < upcoming[j].Days })
+	return upcoming
+}
+
+// ParseDigestTemplate parses a digest template, which must define
+// "subject".
+func ParseDigestTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("digest").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Lookup("subject") == nil {
+		return nil, errors.New(`digest template does not define "subject"`)
+	}
+	return tmpl, nil
+}
+
+// RenderDigest renders a plain text email message of the digest.
+func RenderDigest(w io.Writer, tmpl *template.Template, from string, d Digest) error {
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", d); err != nil {
+		return err
+	}
+	if err := tmpl.Execute(&body, d); err != nil {
+		return err
+	}
+	headers := []string{
+		"From: " + from,
+		"To: " + strings.Join(d.Reminder.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())),
+		"Date: " + d.Date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+	}
+	if _, err := io.WriteString(w, strings.Join(headers, "\r\n")+"\r\n\r\n"); err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write(bytes.Replace(body.Bytes(), []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// SendReminder mails the digest of r for the day of now, unless there are
+// no upcoming birthdays. It reports whether a message was sent.
+func SendReminder(config Config, mail SMTPConfig, from string, r Reminder, tmpl *template.Template, now time.Time) (bool, error) {
+	records, err := List(config, r.Labels)
+	if err != nil {
+		return false, err
+	}
+	d := Digest{Reminder: r, Date: now, Birthdays: UpcomingBirthdays(records, now, r.LeadDays)}
+	if len(d.Birthdays) == 0 {
+		return false, nil
+	}
+	var msg bytes.Buffer
+	if err = RenderDigest(&msg, tmpl, from, d); err != nil {
+		return false, err
+	}
+	return true, SendMail(mail, from, r.To, msg.Bytes())
+}
+
+// SendMail delivers msg through the SMTP server, upgrading the connection
+// with STARTTLS when offered and authenticating when a username is set.
+func SendMail(config SMTPConfig, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(config.Host, config.Port), 30*time.Second)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig := config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: config.Host}
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	} else if config.StartTLS {
+		return fmt.Errorf("smtp server %s does not support STARTTLS", config.Host)
+	}
+	if config.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err = c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = wc.Write(msg); err != nil {
+		return err
+	}
+	if err = wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// NextReminder returns the first time at the clock time at, e.g. "08:00",
+// strictly after now.
+func NextReminder(now time.Time, at string) (time.Time, error) {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reminder time %q is not like 08:00", at)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
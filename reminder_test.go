@@ -0,0 +1,123 @@
+package contacts
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpcomingBirthdays(t *testing.T) {
+	now := time.Date(2026, time.December, 28, 9, 0, 0, 0, time.UTC)
+	records := []*Contact{
+		{Name: "January", Birthday: time.Date(1990, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{Name: "Today", Birthday: time.Date(0, time.December, 28, 0, 0, 0, 0, time.UTC)},
+		{Name: "Later", Birthday: time.Date(1990, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{Name: "None"},
+	}
+	got := UpcomingBirthdays(records, now, 7)
+	if len(got) != 2 || got[0].Contact.Name != "Today" || got[1].Contact.Name != "January" {
+		t.Fatalf("upcoming = %+v", got)
+	}
+	if got[0].Age != "" || got[1].Age != "37 Years" || got[1].Days != 5 {
+		t.Errorf("upcoming = %+v", got)
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	tmpl, err := ParseDigestTemplate(DefaultDigestTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, time.March, 1, 8, 0, 0, 0, time.UTC)
+	d := Digest{
+		Reminder:  Reminder{Labels: []string{"family"}, To: []string{"bob@example.com"}, LeadDays: 7},
+		Date:      now,
+		Birthdays: UpcomingBirthdays([]*Contact{{Name: "Jane Doe", Birthday: time.Date(1980, time.March, 4, 0, 0, 0, 0, time.UTC)}}, now, 7),
+	}
+	var msg bytes.Buffer
+	if err = RenderDigest(&msg, tmpl, "reminders@example.com", d); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg.String(), "Subject: Upcoming birthdays (family)\r\n") ||
+		!strings.Contains(msg.String(), "Wed Mar  4  Jane Doe turns 46 Years") {
+		t.Errorf("digest:\n%s", msg.String())
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 2)
+	go fakeSMTP(ln, received)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	config := SMTPConfig{Host: host, Port: port, Username: "user", Password: "pass"}
+	if err = SendMail(config, "reminders@example.com", d.Reminder.To, msg.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	commands := strings.Join(<-received, "\n")
+	for _, want := range []string{"AUTH PLAIN AHVzZXIAcGFzcw==", "MAIL FROM:<reminders@example.com>", "RCPT TO:<bob@example.com>", "Jane Doe turns 46 Years"} {
+		if !strings.Contains(commands, want) {
+			t.Errorf("smtp session missing %q:\n%s", want, commands)
+		}
+	}
+
+	config.StartTLS = true
+	if err = SendMail(config, "reminders@example.com", d.Reminder.To, msg.Bytes()); err == nil {
+		t.Error("expected an error when STARTTLS is required but not offered")
+	}
+}
+
+// fakeSMTP serves sessions without STARTTLS, sending the lines received
+// in each session on done.
+func fakeSMTP(ln net.Listener, done chan<- []string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go fakeSMTPSession(conn, done)
+	}
+}
+
+func fakeSMTPSession(conn net.Conn, done chan<- []string) {
+	defer conn.Close()
+	var lines []string
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for inData := false; ; {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); {
+		case inData:
+			if line == "." {
+				inData = false
+				reply("250 queued")
+			}
+		case cmd == "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case cmd == "AUTH":
+			reply("235 ok")
+		case cmd == "DATA":
+			inData = true
+			reply("354 go ahead")
+		case cmd == "QUIT":
+			reply("221 bye")
+			done <- lines
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+	done <- lines
+}
@@ -1,7 +1,13 @@
 package contacts
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
@@ -10,50 +16,91 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-func NewWebServer(route string, config Config, templatesFolder string) (http.Handler, error) {
+// NewWebServer returns the handler for the pages, API and DAV collections
+// below route, rendering pages with the templates, or the built in
+// Templates when templates is nil.
+func NewWebServer(route string, config Config, templates fs.FS) (http.Handler, error) {
+	if templates == nil {
+		templates = Templates
+	}
 	server := &server{
 		baseRoute: route,
 		config:    config,
 		tmpl:      template.New("").Funcs(templateFuncs),
+		dav:       &davState{},
+		contacts:  &contactCache{},
+		csrfKey:   newSecret(32),
 	}
 
-	if err := server.init(templatesFolder); err != nil {
+	if err := server.init(templates); err != nil {
 		return nil, err
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc(server.birthdaysRoute(), server.showBirthdays)
-	mux.HandleFunc(server.createRoute(), server.handleCreate)
-	mux.HandleFunc(server.deleteRoute(), server.handleDelete)
-	mux.HandleFunc(server.detailRoute(), server.showDetail)
-	mux.HandleFunc(server.editRoute(), server.handleEdit)
-	mux.HandleFunc(server.listRoute(), server.showList)
-	mux.Handle("/", http.NotFoundHandler())
-	return mux, nil
+	mux.HandleFunc(server.apiRoute()+"/", server.handleAPI)
+	mux.HandleFunc(server.birthdaysRoute(), server.require(RoleViewer, server.showBirthdays))
+	mux.HandleFunc(server.calendarRoute(), server.require(RoleViewer, server.exportCalendar))
+	mux.HandleFunc(server.createRoute(), server.require(RoleEditor, server.handleCreate))
+	mux.HandleFunc(server.davRoute()+"/", server.require(RoleViewer, server.handleDAV))
+	mux.HandleFunc(server.deleteRoute(), server.require(RoleAdmin, server.handleDelete))
+	mux.HandleFunc(server.detailRoute(), server.require(RoleViewer, server.showDetail))
+	mux.HandleFunc(server.editRoute(), server.require(RoleEditor, server.handleEdit))
+	mux.HandleFunc(server.eventsRoute(), server.require(RoleViewer, server.streamEvents))
+	mux.HandleFunc(server.listRoute(), server.require(RoleViewer, server.showList))
+	mux.HandleFunc(server.mailingRoute(), server.require(RoleViewer, server.showMailing))
+	mux.HandleFunc(server.vcardRoute(), server.require(RoleViewer, server.exportVCard))
+	mux.HandleFunc(server.webhooksRoute(), server.require(RoleAdmin, server.showWebhooks))
+	mux.HandleFunc(server.csvRoute(), server.require(RoleViewer, server.exportCSV))
+	mux.HandleFunc(server.ldifRoute(), server.require(RoleViewer, server.exportLDIF))
+	mux.HandleFunc(server.importRoute(), server.require(RoleEditor, server.handleImport))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		server.showError(w, r, errPageNotFound)
+	})
+	return server.recoverPanics(server.protect(server.authenticate(mux))), nil
 }
 
 const (
+	maxImportSize = 10 << 20
+
+	eventsHeartbeat = 30 * time.Second
+
 	birthdaysRoute = "birthdays/"
+	calendarRoute  = "birthdays.ics"
 	createRoute    = "create/"
+	csvRoute       = "csv/"
 	deleteRoute    = "delete/"
 	detailRoute    = "detail/"
 	editRoute      = "edit/"
+	eventsRoute    = "events/"
+	importRoute    = "import/"
+	ldifRoute      = "ldif/"
 	listRoute      = "list/"
+	mailingRoute   = "mailing/"
+	vcardRoute     = "vcard/"
+	webhooksRoute  = "webhooks/"
 
 	birthdaysTemplate = "birthdays.html"
 	createTemplate    = "create.html"
 	deleteTemplate    = "delete.html"
 	detailTemplate    = "detail.html"
 	editTemplate      = "edit.html"
+	importTemplate    = "import.html"
 	listTemplate      = "list.html"
+	mailingTemplate   = "mailing.html"
+	webhooksTemplate  = "webhooks.html"
 )
 
 type server struct {
 	baseRoute string
 	config    Config
 	tmpl      *template.Template
+	dav       *davState
+	contacts  *contactCache
+	users     authCache
+	csrfKey   []byte
 }
 
 type viewData struct {
@@ -61,19 +108,43 @@ type viewData struct {
 	Labels   []string
 	Contacts []*Contact
 	ByMonth  map[string][]*Contact
+	Errors   ValidationErrors
+	Imports  []*ImportItem
+	Webhooks []WebhookDelivery
+	Data     string
+	Status   int
+	Message  string
 	Request  *http.Request
 }
 
-func (s *server) init(templatesFolder string) error {
+// User is the user viewing the page.
+func (v viewData) User() *User { return userFrom(v.Request) }
+
+func (s *server) init(templates fs.FS) error {
 	linkFns := map[string]interface{}{
 		"birthdaysLink": s.birthdaysLink,
+		"calendarLink":  s.calendarLink,
 		"contactsLink":  s.listLink,
 		"createLink":    s.createLink,
+		"csrfToken":     s.csrfToken,
+		"csvLink":       s.csvLink,
 		"deleteLink":    s.deleteLink,
 		"detailLink":    s.detailLink,
 		"editLink":      s.editLink,
-	}
-	if _, err := s.tmpl.Funcs(linkFns).ParseGlob(path.Join(templatesFolder, "*.html")); err != nil {
+		"eventsLink":    s.eventsLink,
+		"importLink":    s.importLink,
+		"ldifLink":      s.ldifLink,
+		"mailingLink":   s.mailingLink,
+		"vcardLink":     s.vcardLink,
+		"webhooksLink":  s.webhooksLink,
+
+		"extraAttributes": s.extraAttributes,
+		"formatPhone":     s.formatPhone,
+		"dialNumber":      s.dialNumber,
+		"addressLabels":   s.addressLabels,
+		"mailingAddress":  s.mailingAddress,
+	}
+	if _, err := s.tmpl.Funcs(linkFns).ParseFS(templates, "*.html"); err != nil {
 		return err
 	}
 	return nil
@@ -96,14 +167,11 @@ func (s *server) handleCreate(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) showCreate(w http.ResponseWriter, r *http.Request) {
 	contact := &Contact{}
-	if err := s.tmpl.ExecuteTemplate(
-		w, createTemplate, viewData{
-			Title:    makeTitle("Create"),
-			Contacts: []*Contact{contact},
-			Request:  r,
-		}); err != nil {
-		log.Fatalf("executing template: %v", err)
-	}
+	s.render(w, r, http.StatusOK, createTemplate, viewData{
+		Title:    makeTitle("Create"),
+		Contacts: []*Contact{contact},
+		Request:  r,
+	})
 }
 
 func (s *server) handleEdit(w http.ResponseWriter, r *http.Request) {
@@ -122,6 +190,10 @@ func (s *server) handleEdit(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleSavePost(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkCSRF(r); err != nil {
+		s.showError(w, r, err)
+		return
+	}
 	switch r.Form.Get("submit") {
 	case "Save":
 		old, err := Single(s.config, r.Form.Get("dn"))
@@ -129,9 +201,18 @@ func (s *server) handleSavePost(w http.ResponseWriter, r *http.Request) {
 			log.Printf("error getting old %q: %v", r.Form.Get("dn"), err)
 			old = &Contact{}
 		}
-		if err = Save(s.config, old, contactFromForm(r.Form)); err != nil {
-			log.Printf("error saving: %v", err)
-			http.Error(w, "unexpected error", http.StatusInternalServerError)
+		updated := contactFromForm(r.Form, s.config.isEditable)
+		if errs := formErrors(r.Form).merge(updated.validate()); errs != nil {
+			s.showInvalid(w, r, old, updated, errs)
+			return
+		}
+		if err = Save(s.config, old, updated); err != nil {
+			var errs ValidationErrors
+			if errors.As(err, &errs) {
+				s.showInvalid(w, r, old, updated, errs)
+				return
+			}
+			s.showError(w, r, fmt.Errorf("saving %q: %w", updated.ID, err))
 			return
 		}
 	default:
@@ -139,23 +220,45 @@ func (s *server) handleSavePost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, s.listLink(nil), http.StatusSeeOther)
 }
 
+// showInvalid re-renders the create or edit form with the submitted values
+// and the errors that prevented saving them. The form does not submit
+// read-only attributes, so they are shown from original.
+func (s *server) showInvalid(w http.ResponseWriter, r *http.Request, original, updated *Contact, errs ValidationErrors) {
+	contact := *updated
+	contact.Extra = map[string][]string{}
+	if original != nil && original.ID == updated.ID {
+		for name, values := range original.Extra {
+			contact.Extra[name] = values
+		}
+	}
+	for name, values := range updated.Extra {
+		contact.Extra[name] = values
+	}
+	tmpl, title := createTemplate, makeTitle("Create")
+	if contact.ID != "" {
+		tmpl, title = editTemplate, makeTitle("Edit", contact.DisplayName())
+	}
+	s.render(w, r, http.StatusUnprocessableEntity, tmpl, viewData{
+		Title:    title,
+		Contacts: []*Contact{&contact},
+		Errors:   errs,
+		Request:  r,
+	})
+}
+
 func (s *server) showEdit(w http.ResponseWriter, r *http.Request) {
 	dn := r.Form.Get("dn")
 	contact, err := Single(s.config, dn)
 	if err != nil {
-		log.Printf("finding %q: %v", dn, err)
-		http.NotFound(w, r)
+		s.showError(w, r, fmt.Errorf("finding %q: %w", dn, err))
 		return
 	}
 
-	if err = s.tmpl.ExecuteTemplate(
-		w, editTemplate, viewData{
-			Title:    makeTitle("Edit", contact.DisplayName()),
-			Contacts: []*Contact{contact},
-			Request:  r,
-		}); err != nil {
-		log.Fatalf("executing template: %v", err)
-	}
+	s.render(w, r, http.StatusOK, editTemplate, viewData{
+		Title:    makeTitle("Edit", contact.DisplayName()),
+		Contacts: []*Contact{contact},
+		Request:  r,
+	})
 }
 
 func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
@@ -174,11 +277,14 @@ func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleDeletePost(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkCSRF(r); err != nil {
+		s.showError(w, r, err)
+		return
+	}
 	switch r.Form.Get("submit") {
 	case "Delete":
 		if err := Delete(s.config, r.Form.Get("dn")); err != nil {
-			log.Printf("error deleting: %v", err)
-			http.Error(w, "unexpected error", http.StatusInternalServerError)
+			s.showError(w, r, fmt.Errorf("deleting %q: %w", r.Form.Get("dn"), err))
 			return
 		}
 	default:
@@ -190,18 +296,103 @@ func (s *server) showDelete(w http.ResponseWriter, r *http.Request) {
 	dn := r.Form.Get("dn")
 	contact, err := Single(s.config, dn)
 	if err != nil {
-		log.Printf("finding %q: %v", dn, err)
-		http.NotFound(w, r)
+		s.showError(w, r, fmt.Errorf("finding %q: %w", dn, err))
+		return
+	}
+	s.render(w, r, http.StatusOK, deleteTemplate, viewData{
+		Title:    makeTitle("Confirm Delete", contact.DisplayName()),
+		Contacts: []*Contact{contact},
+		Request:  r,
+	})
+}
+
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxImportSize); err != nil && err != http.ErrNotMultipart {
+		log.Printf("handleImport: error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		s.handleImportPost(w, r)
+	default:
+		s.showImport(w, r, "", nil)
+	}
+}
+
+// handleImportPost previews an uploaded file, or imports a previewed one.
+// The data being imported is carried in the preview form so nothing is
+// kept on the server between the two steps.
+func (s *server) handleImportPost(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkCSRF(r); err != nil {
+		s.showError(w, r, err)
+		return
+	}
+	submit := r.Form.Get("submit")
+	if submit != "Preview" && submit != "Import" {
+		http.Redirect(w, r, s.listLink(nil), http.StatusSeeOther)
+		return
+	}
+
+	data := r.Form.Get("data")
+	if file, _, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		b, err := ioutil.ReadAll(file)
+		if err != nil {
+			log.Printf("error reading upload: %v", err)
+			http.Error(w, "Bad Input", http.StatusBadRequest)
+			return
+		}
+		data = string(b)
+	}
+
+	incoming, err := parseImport(r.Form, data)
+	if err != nil {
+		log.Printf("error parsing import: %v", err)
+		http.Error(w, fmt.Sprintf("Bad Input: %v", err), http.StatusBadRequest)
+		return
+	}
+	items, err := PlanImport(s.config, incoming)
+	if err != nil {
+		s.showError(w, r, fmt.Errorf("planning import: %w", err))
+		return
+	}
+
+	if submit == "Preview" {
+		s.showImport(w, r, data, items)
 		return
 	}
-	if err := s.tmpl.ExecuteTemplate(
-		w, deleteTemplate, viewData{
-			Title:    makeTitle("Confirm Delete", contact.DisplayName()),
-			Contacts: []*Contact{contact},
-			Request:  r,
-		}); err != nil {
-		log.Fatalf("executing template: %v", err)
+	if _, err = ApplyImport(s.config, items); err != nil {
+		log.Printf("error importing: %v", err)
+		s.showImport(w, r, data, items)
+		return
 	}
+	http.Redirect(w, r, s.listLink(nil), http.StatusSeeOther)
+}
+
+// parseImport reads contacts from data in the format selected on the import
+// form.
+func parseImport(v url.Values, data string) ([]*Contact, error) {
+	switch v.Get("format") {
+	case "csv":
+		mapping, err := ParseCSVMapping(v.Get("mapping"))
+		if err != nil {
+			return nil, err
+		}
+		return ReadCSV(strings.NewReader(data), v.Get("preset"), mapping)
+	default:
+		return ParseVCards(strings.NewReader(data))
+	}
+}
+
+func (s *server) showImport(w http.ResponseWriter, r *http.Request, data string, items []*ImportItem) {
+	s.render(w, r, http.StatusOK, importTemplate, viewData{
+		Title:   makeTitle("Import"),
+		Imports: items,
+		Data:    data,
+		Request: r,
+	})
 }
 
 func (s *server) showDetail(w http.ResponseWriter, r *http.Request) {
@@ -214,18 +405,15 @@ func (s *server) showDetail(w http.ResponseWriter, r *http.Request) {
 	dn := r.Form.Get("dn")
 	contact, err := Single(s.config, dn)
 	if err != nil {
-		log.Fatal(err)
+		s.showError(w, r, fmt.Errorf("finding %q: %w", dn, err))
+		return
 	}
 
-	if err = s.tmpl.ExecuteTemplate(
-		w, detailTemplate,
-		viewData{
-			Title:    makeTitle("Detail", contact.DisplayName()),
-			Contacts: []*Contact{contact},
-			Request:  r,
-		}); err != nil {
-		log.Fatal(err)
-	}
+	s.render(w, r, http.StatusOK, detailTemplate, viewData{
+		Title:    makeTitle("Detail", contact.DisplayName()),
+		Contacts: []*Contact{contact},
+		Request:  r,
+	})
 }
 
 func (s *server) showList(w http.ResponseWriter, r *http.Request) {
@@ -238,18 +426,228 @@ func (s *server) showList(w http.ResponseWriter, r *http.Request) {
 	labels := r.Form["label"]
 	records, err := List(s.config, labels)
 	if err != nil {
-		log.Fatal(err)
+		s.showError(w, r, fmt.Errorf("listing contacts: %w", err))
+		return
+	}
+	records = Search(records, r.Form.Get("q"))
+	sort.Sort(sortBy(r.Form.Get("sort"), records))
+	s.render(w, r, http.StatusOK, listTemplate, viewData{
+		Title:    makeTitle("Contacts", labels...),
+		Labels:   labels,
+		Contacts: records,
+		Request:  r,
+	})
+}
+
+func (s *server) showMailing(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+
+	labels := r.Form["label"]
+	records, err := List(s.config, labels)
+	if err != nil {
+		s.showError(w, r, fmt.Errorf("listing contacts: %w", err))
+		return
+	}
+	var addressed []*Contact
+	for _, contact := range Search(records, r.Form.Get("q")) {
+		if contact.HasAddress() {
+			addressed = append(addressed, contact)
+		}
+	}
+	sort.Sort(ByLastName(addressed))
+	s.render(w, r, http.StatusOK, mailingTemplate, viewData{
+		Title:    makeTitle("Mailing Labels", labels...),
+		Labels:   labels,
+		Contacts: addressed,
+		Request:  r,
+	})
+}
+
+// streamEvents sends contact changes as server-sent events until the
+// client goes away, replaying those after the Last-Event-ID it reconnects
+// with.
+func (s *server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming Unsupported", http.StatusInternalServerError)
+		return
+	}
+	since, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	events, missed, cancel := SubscribeChanges(since)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	for _, e := range missed {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	// The stream outlives the server's read and write timeouts, so reads
+	// never time out and each write gets until the next heartbeat instead.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Now().Add(2 * eventsHeartbeat))
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+		rc.SetWriteDeadline(time.Now().Add(2 * eventsHeartbeat))
+	}
+}
+
+func writeEvent(w io.Writer, e ChangeEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("encoding event: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+}
+
+// showWebhooks lists the most recent webhook deliveries.
+func (s *server) showWebhooks(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+	s.render(w, r, http.StatusOK, webhooksTemplate, viewData{
+		Title:    makeTitle("Webhook Deliveries"),
+		Webhooks: WebhookDeliveries(),
+		Request:  r,
+	})
+}
+
+// exportVCard downloads a single contact, when a dn is given, or all the
+// contacts matching the same filters as showList, as vCards.
+func (s *server) exportVCard(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+
+	records, filename, err := s.exportRecords(r)
+	if err != nil {
+		s.showError(w, r, fmt.Errorf("exporting vcards: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".vcf"))
+	if err = WriteVCards(w, r.Form.Get("version"), s.config.DefaultRegion, records...); err != nil {
+		log.Printf("writing vcards: %v", err)
+	}
+}
+
+// exportCSV downloads the same contacts as exportVCard as CSV, using the
+// columns of the requested preset.
+func (s *server) exportCSV(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+	if preset := r.Form.Get("preset"); preset != "" {
+		if _, ok := CSVPresets[preset]; !ok {
+			http.Error(w, "Bad Input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, filename, err := s.exportRecords(r)
+	if err != nil {
+		s.showError(w, r, fmt.Errorf("exporting csv: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+	if err = WriteCSV(w, r.Form.Get("preset"), records...); err != nil {
+		log.Printf("writing csv: %v", err)
+	}
+}
+
+// exportLDIF downloads the directory entries selected by the label filter
+// as LDIF, for backups and moving between directory servers.
+func (s *server) exportLDIF(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+
+	labels := r.Form["label"]
+	var b strings.Builder
+	if err := ExportLDIF(s.config, &b, labels); err != nil {
+		s.showError(w, r, fmt.Errorf("exporting ldif: %w", err))
+		return
+	}
+	filename := fileName(strings.Join(append([]string{"contacts"}, labels...), "-"))
+	w.Header().Set("Content-Type", "text/x-ldif; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".ldif"))
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		log.Printf("writing ldif: %v", err)
+	}
+}
+
+// exportRecords returns the contacts selected by the export request along
+// with a file name, without extension, describing them.
+func (s *server) exportRecords(r *http.Request) ([]*Contact, string, error) {
+	if dn := r.Form.Get("dn"); dn != "" {
+		contact, err := Single(s.config, dn)
+		if err != nil {
+			return nil, "", err
+		}
+		return []*Contact{contact}, fileName(contact.DisplayName()), nil
+	}
+	labels := r.Form["label"]
+	records, err := List(s.config, labels)
+	if err != nil {
+		return nil, "", err
 	}
+	records = Search(records, r.Form.Get("q"))
 	sort.Sort(ByName(records))
-	if err = s.tmpl.ExecuteTemplate(
-		w, listTemplate,
-		viewData{
-			Title:    makeTitle("Contacts", labels...),
-			Labels:   labels,
-			Contacts: records,
-			Request:  r,
-		}); err != nil {
-		log.Fatal(err)
+	return records, fileName(strings.Join(append([]string{"contacts"}, labels...), "-")), nil
+}
+
+// exportCalendar serves the birthdays matching the label filter as an
+// iCalendar feed suitable for subscribing to.
+func (s *server) exportCalendar(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Printf("error parsing form: %v", err)
+		http.Error(w, "Bad Input", http.StatusBadRequest)
+		return
+	}
+
+	labels := r.Form["label"]
+	records, err := List(s.config, labels)
+	if err != nil {
+		s.showError(w, r, fmt.Errorf("listing birthdays: %w", err))
+		return
+	}
+	records = Search(records, r.Form.Get("q"))
+	sort.Sort(ByBirthday(records))
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err = WriteICS(w, makeTitle("Birthdays", labels...), records, time.Now()); err != nil {
+		log.Printf("writing calendar: %v", err)
 	}
 }
 
@@ -263,39 +661,111 @@ func (s *server) showBirthdays(w http.ResponseWriter, r *http.Request) {
 	labels := r.Form["label"]
 	records, err := List(s.config, labels)
 	if err != nil {
-		log.Fatal(err)
+		s.showError(w, r, fmt.Errorf("listing contacts: %w", err))
+		return
 	}
+	records = Search(records, r.Form.Get("q"))
 	sort.Sort(ByBirthday(records))
 	ordered := map[string][]*Contact{}
 	for _, contact := range records {
 		ordered[contact.BirthMonth()] = append(ordered[contact.BirthMonth()], contact)
 	}
-	if err = s.tmpl.ExecuteTemplate(
-		w, birthdaysTemplate,
-		viewData{
-			Title:    makeTitle("Birthdays", labels...),
-			Labels:   labels,
-			Contacts: records,
-			ByMonth:  ordered,
-			Request:  r,
-		}); err != nil {
-		log.Fatal(err)
+	s.render(w, r, http.StatusOK, birthdaysTemplate, viewData{
+		Title:    makeTitle("Birthdays", labels...),
+		Labels:   labels,
+		Contacts: records,
+		ByMonth:  ordered,
+		Request:  r,
+	})
+}
+
+// attribute is an unmapped directory attribute as presented in templates.
+type attribute struct {
+	Name     string
+	Values   []string
+	Editable bool
+}
+
+// extraAttributes lists the unmapped attributes of contact together with any
+// configured editable attributes it does not have yet.
+func (s *server) extraAttributes(contact *Contact) []attribute {
+	seen := map[string]bool{}
+	var attrs []attribute
+	for _, name := range s.config.EditableAttributes {
+		if !s.config.isEditable(name) || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		attrs = append(attrs, attribute{Name: name, Values: contact.ExtraValues(name), Editable: true})
+	}
+	if contact != nil {
+		for name, values := range contact.Extra {
+			if seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			attrs = append(attrs, attribute{Name: name, Values: printable(values)})
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return strings.ToLower(attrs[i].Name) < strings.ToLower(attrs[j].Name) })
+	return attrs
+}
+
+// formatPhone formats number for display relative to the contact's region.
+func (s *server) formatPhone(contact *Contact, number string) string {
+	region := contact.region(s.config.DefaultRegion)
+	if normalized, ok := NormalizePhone(number, region); ok {
+		return FormatPhone(normalized, region)
 	}
+	return number
+}
+
+// dialNumber returns number in the form used for tel: links.
+func (s *server) dialNumber(contact *Contact, number string) string {
+	normalized, _ := NormalizePhone(number, contact.region(s.config.DefaultRegion))
+	return normalized
+}
+
+// addressLabels returns the address field names for the contact's country.
+func (s *server) addressLabels(contact *Contact) AddressLabels {
+	return AddressLabelsFor(contact.region(s.config.DefaultRegion))
+}
+
+// mailingAddress returns the contact's address as it should be written on
+// mail sent from the default region.
+func (s *server) mailingAddress(contact *Contact) []string {
+	return contact.MailingAddress(s.config.DefaultRegion)
 }
 
 func (s *server) birthdaysRoute() string { return path.Join(s.baseRoute, birthdaysRoute) }
+func (s *server) calendarRoute() string  { return path.Join(s.baseRoute, calendarRoute) }
 func (s *server) createRoute() string    { return path.Join(s.baseRoute, createRoute) }
+func (s *server) csvRoute() string       { return path.Join(s.baseRoute, csvRoute) }
 func (s *server) deleteRoute() string    { return path.Join(s.baseRoute, deleteRoute) }
 func (s *server) detailRoute() string    { return path.Join(s.baseRoute, detailRoute) }
 func (s *server) editRoute() string      { return path.Join(s.baseRoute, editRoute) }
+func (s *server) eventsRoute() string    { return path.Join(s.baseRoute, eventsRoute) }
+func (s *server) importRoute() string    { return path.Join(s.baseRoute, importRoute) }
+func (s *server) ldifRoute() string      { return path.Join(s.baseRoute, ldifRoute) }
 func (s *server) listRoute() string      { return path.Join(s.baseRoute, listRoute) }
+func (s *server) mailingRoute() string   { return path.Join(s.baseRoute, mailingRoute) }
+func (s *server) vcardRoute() string     { return path.Join(s.baseRoute, vcardRoute) }
+func (s *server) webhooksRoute() string  { return path.Join(s.baseRoute, webhooksRoute) }
 
 func (s *server) birthdaysLink(v url.Values) string { return makelink(s.birthdaysRoute, listFilter, v) }
+func (s *server) calendarLink(v url.Values) string  { return makelink(s.calendarRoute, listFilter, v) }
 func (s *server) createLink(v url.Values) string    { return makelink(s.createRoute, noneFilter, v) }
+func (s *server) csvLink(v url.Values) string       { return makelink(s.csvRoute, exportFilter, v) }
 func (s *server) deleteLink(v url.Values) string    { return makelink(s.deleteRoute, noneFilter, v) }
 func (s *server) detailLink(v url.Values) string    { return makelink(s.detailRoute, detailFilter, v) }
 func (s *server) editLink(v url.Values) string      { return makelink(s.editRoute, detailFilter, v) }
+func (s *server) eventsLink(v url.Values) string    { return makelink(s.eventsRoute, noneFilter, v) }
+func (s *server) importLink(v url.Values) string    { return makelink(s.importRoute, noneFilter, v) }
+func (s *server) ldifLink(v url.Values) string      { return makelink(s.ldifRoute, listFilter, v) }
 func (s *server) listLink(v url.Values) string      { return makelink(s.listRoute, listFilter, v) }
+func (s *server) mailingLink(v url.Values) string   { return makelink(s.mailingRoute, listFilter, v) }
+func (s *server) vcardLink(v url.Values) string     { return makelink(s.vcardRoute, exportFilter, v) }
+func (s *server) webhooksLink(v url.Values) string  { return makelink(s.webhooksRoute, noneFilter, v) }
 
 //
 // Helpers
@@ -317,11 +787,14 @@ var (
 		"December":  time.December,
 	}
 	detailFilter = []string{"dn"}
-	listFilter   = []string{"label"}
+	listFilter   = []string{"label", "q", "sort"}
+	exportFilter = []string{"dn", "label", "q", "version", "preset"}
 	noneFilter   = []string(nil)
 )
 
-func contactFromForm(v url.Values) *Contact {
+const extraFieldPrefix = "extra."
+
+func contactFromForm(v url.Values, editable func(string) bool) *Contact {
 	birthday := time.Time{}
 	if month, ok := monthValues[v.Get("birthMonth")]; ok {
 		if day, err := strconv.Atoi(v.Get("birthDay")); err == nil {
@@ -332,12 +805,29 @@ func contactFromForm(v url.Values) *Contact {
 			birthday = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
 		}
 	}
-	return &Contact{
+	var extra map[string][]string
+	for k := range v {
+		if !strings.HasPrefix(k, extraFieldPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(k, extraFieldPrefix)
+		if editable == nil || !editable(name) {
+			continue
+		}
+		if extra == nil {
+			extra = map[string][]string{}
+		}
+		extra[name] = dedupe(v[k])
+	}
+	contact := &Contact{
 		ID:       v.Get("dn"),
 		Name:     v.Get("displayName"),
+		Prefix:   v.Get("prefix"),
 		First:    v.Get("given"),
+		Middle:   v.Get("middle"),
 		Last:     v.Get("sn"),
 		Suffix:   v.Get("generation"),
+		Nickname: dedupe(v["nickname"]),
 		Street:   dedupe(v["street"]),
 		City:     v.Get("city"),
 		State:    v.Get("state"),
@@ -347,8 +837,60 @@ func contactFromForm(v url.Values) *Contact {
 		Email:    dedupe(v["mail"]),
 		Phone:    dedupe(v["telephoneNumber"]),
 		Labels:   dedupe(v["label"]),
+
+		PhoneticFirst: v.Get("phoneticGiven"),
+		PhoneticLast:  v.Get("phoneticSn"),
+
+		Extra: extra,
+	}
+	// A contact created from just a display name gets its parts parsed out.
+	if contact.ID == "" && contact.Name != "" && contact.Prefix == "" && contact.First == "" && contact.Middle == "" && contact.Last == "" {
+		n := ParseName(contact.Name)
+		n.Suffix = firstNonEmpty(contact.Suffix, n.Suffix)
+		contact.SetName(n)
 	}
+	return contact
 }
+
+func sortBy(key string, records []*Contact) sort.Interface {
+	switch key {
+	case "last":
+		return ByLastName(records)
+	case "phonetic":
+		return ByPhoneticName(records)
+	case "phonetic-last":
+		return ByPhoneticLastName(records)
+	default:
+		return ByName(records)
+	}
+}
+
+func printable(values []string) []string {
+	out := make([]string, len(values))
+	for i, value := range values {
+		if utf8.ValidString(value) {
+			out[i] = value
+		} else {
+			out[i] = "(binary)"
+		}
+	}
+	return out
+}
+
+// fileName replaces characters that are awkward in file names.
+func fileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return "contact"
+	}
+	return name
+}
+
 func makeTitle(main string, parts ...string) string {
 	return strings.Join(append([]string{main}, parts...), " :: ")
 }
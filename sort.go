@@ -12,6 +12,22 @@ func (b ByLastName) Len() int           { return len(b) }
 func (b ByLastName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
 func (b ByLastName) Less(i, j int) bool { return compareName(b[i], b[j]) }
 
+// ByPhoneticName sorts like ByName, but uses the phonetic reading of the
+// name when one is available.
+type ByPhoneticName []*Contact
+
+func (b ByPhoneticName) Len() int           { return len(b) }
+func (b ByPhoneticName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b ByPhoneticName) Less(i, j int) bool { return comparePhoneticDisplay(b[i], b[j]) }
+
+// ByPhoneticLastName sorts like ByLastName, but uses the phonetic first and
+// last names when they are available.
+type ByPhoneticLastName []*Contact
+
+func (b ByPhoneticLastName) Len() int           { return len(b) }
+func (b ByPhoneticLastName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b ByPhoneticLastName) Less(i, j int) bool { return comparePhoneticName(b[i], b[j]) }
+
 type ByBirthday []*Contact
 
 func (b ByBirthday) Len() int           { return len(b) }
@@ -55,11 +71,50 @@ func compareName(lhs, rhs *Contact) bool {
 	if rhs == nil {
 		return false
 	}
-	if lhs.Last == rhs.Last {
+	ll, rl := lastNameSortKey(lhs.Last), lastNameSortKey(rhs.Last)
+	if ll == rl {
 		if lhs.First == rhs.First {
 			return compareDisplay(lhs, rhs)
 		}
 		return lhs.First < rhs.First
 	}
-	return lhs.Last < rhs.Last
+	return ll < rl
+}
+
+func comparePhoneticDisplay(lhs, rhs *Contact) bool {
+	if lhs == rhs {
+		return false
+	}
+	if lhs == nil {
+		return true
+	}
+	if rhs == nil {
+		return false
+	}
+	if lhs.PhoneticName() == rhs.PhoneticName() {
+		return compareDisplay(lhs, rhs)
+	}
+	return lhs.PhoneticName() < rhs.PhoneticName()
+}
+
+func comparePhoneticName(lhs, rhs *Contact) bool {
+	if lhs == rhs {
+		return false
+	}
+	if lhs == nil {
+		return true
+	}
+	if rhs == nil {
+		return false
+	}
+	ll := firstNonEmpty(lhs.PhoneticLast, lastNameSortKey(lhs.Last))
+	rl := firstNonEmpty(rhs.PhoneticLast, lastNameSortKey(rhs.Last))
+	if ll == rl {
+		lf, rf := firstNonEmpty(lhs.PhoneticFirst, lhs.First), firstNonEmpty(rhs.PhoneticFirst, rhs.First)
+		if lf == rf {
+			return compareName(lhs, rhs)
+		}
+		return lf < rf
+	}
+	return ll < rl
 }
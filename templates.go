@@ -17,6 +17,7 @@ var (
 		"makeValues":  makeValues,
 		"mailtoLink":  mailtoLink,
 		"mailtoLinks": mailtoLinks,
+		"csvPresets":  CSVPresetNames,
 	}
 	monthNames = []string{
 		"January",
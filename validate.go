@@ -0,0 +1,125 @@
+package contacts
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationErrors maps a Contact field name to a description of what is
+// wrong with its value.
+type ValidationErrors map[string]string
+
+func (v ValidationErrors) Error() string {
+	var fields []string
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var msgs []string
+	for _, field := range fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", field, v[field]))
+	}
+	return "invalid contact: " + strings.Join(msgs, "; ")
+}
+
+func (v ValidationErrors) add(field, format string, args ...interface{}) ValidationErrors {
+	if v == nil {
+		v = ValidationErrors{}
+	}
+	if _, ok := v[field]; !ok {
+		v[field] = fmt.Sprintf(format, args...)
+	}
+	return v
+}
+
+func (v ValidationErrors) merge(other ValidationErrors) ValidationErrors {
+	for field, msg := range other {
+		v = v.add(field, "%s", msg)
+	}
+	return v
+}
+
+// Validate checks the contact for values that should not be saved. It
+// returns nil, or a ValidationErrors describing each invalid field.
+func (c *Contact) Validate() error {
+	if errs := c.validate(); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func (c *Contact) validate() ValidationErrors {
+	var errs ValidationErrors
+	if c == nil {
+		return errs.add("Name", "contact is empty")
+	}
+	if strings.TrimSpace(c.DisplayName()) == "" {
+		errs = errs.add("Name", "a display, first or last name is required")
+	}
+	for _, email := range c.Email {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			errs = errs.add("Email", "%q is not a valid email address", email)
+		}
+	}
+	for _, phone := range c.Phone {
+		if !validPhone(phone) {
+			errs = errs.add("Phone", "%q is not a valid telephone number", phone)
+		}
+	}
+	if !c.Birthday.IsZero() && c.Birthday.Year() > 0 && c.Birthday.After(time.Now()) {
+		errs = errs.add("Birthday", "birthday is in the future")
+	}
+	return errs
+}
+
+func validPhone(phone string) bool {
+	digits := 0
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("+-.() /x", r):
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// formErrors reports problems with form values that cannot be represented
+// in a Contact, such as a day that does not exist in the selected month.
+func formErrors(v url.Values) ValidationErrors {
+	var errs ValidationErrors
+	dayValue, monthValue, yearValue := v.Get("birthDay"), v.Get("birthMonth"), v.Get("birthYear")
+	if dayValue == "" && monthValue == "" && yearValue == "" {
+		return errs
+	}
+	month, ok := monthValues[monthValue]
+	if !ok {
+		return errs.add("Birthday", "a birthday needs a month")
+	}
+	day, err := strconv.Atoi(dayValue)
+	if err != nil {
+		return errs.add("Birthday", "a birthday needs a day")
+	}
+	year := 0
+	if yearValue != "" {
+		if year, err = strconv.Atoi(yearValue); err != nil {
+			return errs.add("Birthday", "%q is not a valid year", yearValue)
+		}
+	}
+	// Year zero is a leap year, so February 29 is allowed without a year.
+	if date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC); date.Day() != day || date.Month() != month {
+		if year == 0 {
+			return errs.add("Birthday", "%s %d is not a valid date", month, day)
+		}
+		return errs.add("Birthday", "%s %d, %d is not a valid date", month, day, year)
+	}
+	return errs
+}
@@ -0,0 +1,67 @@
+package contacts
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := (&Contact{}).Validate(); err == nil {
+		t.Errorf("expected empty contact to be invalid")
+	}
+	c := &Contact{First: "Jane", Email: []string{"jane@example.org", "Jane <jane@example.org>", "nope"}}
+	err := c.Validate()
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if _, ok := errs["Email"]; !ok || len(errs) != 1 {
+		t.Errorf("expected only an Email error: %+v", errs)
+	}
+	if err := (&Contact{Last: "Doe", Phone: []string{"(555) 123-4567"}}).Validate(); err != nil {
+		t.Errorf("expected valid contact: %v", err)
+	}
+}
+
+func TestFormErrorsBirthday(t *testing.T) {
+	cases := []struct {
+		day, month, year string
+		valid            bool
+	}{
+		{"", "", "", true},
+		{"28", "February", "2001", true},
+		{"29", "February", "", true},
+		{"29", "February", "2001", false},
+		{"31", "February", "", false},
+		{"31", "April", "1990", false},
+		{"12", "", "", false},
+	}
+	for _, c := range cases {
+		v := url.Values{"birthDay": {c.day}, "birthMonth": {c.month}, "birthYear": {c.year}}
+		errs := formErrors(v)
+		if (errs == nil) != c.valid {
+			t.Errorf("%s %s %s: expected valid=%t, got %v", c.month, c.day, c.year, c.valid, errs)
+		}
+	}
+}
+
+func TestShowInvalidKeepsReadOnlyAttributes(t *testing.T) {
+	s := &server{baseRoute: "/contacts/", tmpl: template.New("").Funcs(templateFuncs)}
+	if err := s.init(Templates); err != nil {
+		t.Fatal(err)
+	}
+	original := &Contact{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe", Extra: map[string][]string{"employeeNumber": {"E-1234"}}}
+	updated := &Contact{ID: original.ID, Name: "Jane Doe", Email: []string{"nope"}}
+	w := httptest.NewRecorder()
+	s.showInvalid(w, httptest.NewRequest("POST", "/contacts/edit", nil), original, updated, updated.validate())
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "E-1234") {
+		t.Errorf("%d: read-only attribute missing from\n%s", w.Code, w.Body)
+	}
+	if updated.Extra != nil {
+		t.Errorf("updated contact changed: %v", updated.Extra)
+	}
+}
@@ -0,0 +1,441 @@
+package contacts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	VCard3 = "3.0"
+	VCard4 = "4.0"
+
+	vcardLineLength = 75
+
+	// vcardUIDAttribute keeps the UID of vCards created over CardDAV.
+	vcardUIDAttribute = "uid"
+)
+
+// WriteVCards writes contacts to w as vCards of the given version, which is
+// VCard3 or VCard4 (the default). Phone numbers of contacts without a
+// country are read as numbers in region.
+func WriteVCards(w io.Writer, version, region string, contacts ...*Contact) error {
+	bw := bufio.NewWriter(w)
+	for _, contact := range contacts {
+		if contact == nil {
+			continue
+		}
+		for _, line := range contact.vcardLines(version, region) {
+			if _, err := bw.WriteString(foldLine(line)); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// VCard returns the contact as a vCard of the given version, reading phone
+// numbers as in WriteVCards.
+func (c *Contact) VCard(version, region string) string {
+	var b strings.Builder
+	_ = WriteVCards(&b, version, region, c)
+	return b.String()
+}
+
+// VCardUID is the UID of the contact's vCard: the one it was created with,
+// or else one derived from its ID.
+func (c *Contact) VCardUID() string {
+	if uids := c.ExtraValues(vcardUIDAttribute); len(uids) > 0 {
+		return uids[0]
+	}
+	return "urn:uuid:" + c.UUID()
+}
+
+// readVCardUID returns the UID of the first vCard in data.
+func readVCardUID(data string) string {
+	lines, _ := unfoldLines(strings.NewReader(data))
+	for _, line := range lines {
+		prop, ok := parseVCardLine(line)
+		switch {
+		case !ok:
+		case prop.Name == "UID":
+			return strings.TrimSpace(prop.Value)
+		case prop.Name == "END":
+			return ""
+		}
+	}
+	return ""
+}
+
+func (c *Contact) vcardLines(version, region string) []string {
+	if version != VCard3 {
+		version = VCard4
+	}
+	lines := []string{"BEGIN:VCARD", "VERSION:" + version}
+	add := func(format string, args ...interface{}) { lines = append(lines, fmt.Sprintf(format, args...)) }
+
+	add("FN:%s", escapeVCard(c.DisplayName()))
+	add("N:%s;%s;%s;%s;%s",
+		escapeVCard(c.Last), escapeVCard(c.First), escapeVCard(c.Middle),
+		escapeVCard(c.Prefix), escapeVCard(c.Suffix))
+	if len(c.Nickname) > 0 {
+		add("NICKNAME:%s", escapeVCardList(c.Nickname))
+	}
+	if c.PhoneticFirst != "" {
+		add("X-PHONETIC-FIRST-NAME:%s", escapeVCard(c.PhoneticFirst))
+	}
+	if c.PhoneticLast != "" {
+		add("X-PHONETIC-LAST-NAME:%s", escapeVCard(c.PhoneticLast))
+	}
+	for _, email := range c.Email {
+		if version == VCard3 {
+			add("EMAIL;TYPE=INTERNET:%s", escapeVCard(email))
+		} else {
+			add("EMAIL:%s", escapeVCard(email))
+		}
+	}
+	for _, phone := range c.Phone {
+		normalized, ok := NormalizePhone(phone, c.region(region))
+		switch {
+		case ok && version == VCard4:
+			add("TEL;VALUE=uri:tel:%s", normalized)
+		case ok:
+			add("TEL;TYPE=VOICE:%s", normalized)
+		default:
+			add("TEL:%s", escapeVCard(phone))
+		}
+	}
+	if c.HasAddress() {
+		adr := fmt.Sprintf(";;%s;%s;%s;%s;%s",
+			escapeVCardList(c.Street), escapeVCard(c.City), escapeVCard(c.State),
+			escapeVCard(c.Zip), escapeVCard(countryName(countryCode(c.Country))))
+		label := strings.Join(c.AddressLines(), "\n")
+		if version == VCard4 {
+			add("ADR;LABEL=\"%s\":%s", paramEscaper.Replace(label), adr)
+		} else {
+			add("ADR:%s", adr)
+			add("LABEL:%s", escapeVCard(label))
+		}
+	}
+	if !c.Birthday.IsZero() {
+		switch {
+		case c.Birthday.Year() == 0:
+			add("BDAY:%s", c.Birthday.Format("--0102"))
+		case version == VCard4:
+			add("BDAY:%s", c.Birthday.Format("20060102"))
+		default:
+			add("BDAY:%s", c.Birthday.Format("2006-01-02"))
+		}
+	}
+	if len(c.Labels) > 0 {
+		add("CATEGORIES:%s", escapeVCardList(c.Labels))
+	}
+	if c.ID != "" {
+		add("UID:%s", c.VCardUID())
+	}
+	return append(lines, "END:VCARD")
+}
+
+var vcardEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	",", `\,`,
+	";", `\;`,
+)
+
+// paramEscaper encodes parameter values as described in RFC 6868.
+var paramEscaper = strings.NewReplacer(
+	"^", "^^",
+	"\r\n", "^n",
+	"\n", "^n",
+	`"`, "^'",
+)
+
+func escapeVCard(value string) string { return vcardEscaper.Replace(value) }
+
+func escapeVCardList(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = escapeVCard(value)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// foldLine terminates line with CRLF, folding it so no physical line is
+// longer than 75 octets, without splitting a UTF-8 sequence.
+func foldLine(line string) string {
+	var b strings.Builder
+	limit := vcardLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = vcardLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// ParseVCards reads every vCard in r. Versions 2.1, 3.0 and 4.0 are
+// understood, including folded lines and quoted-printable values.
+func ParseVCards(r io.Reader) ([]*Contact, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		contacts []*Contact
+		current  *Contact
+	)
+	for n, line := range lines {
+		prop, ok := parseVCardLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VCARD"):
+			current = &Contact{}
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VCARD"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END without BEGIN", n+1)
+			}
+			contacts = append(contacts, current.finishVCard())
+			current = nil
+		case current != nil:
+			current.setVCardProperty(prop)
+		}
+	}
+	if current != nil {
+		return nil, errors.New("vcard not terminated with END:VCARD")
+	}
+	return contacts, nil
+}
+
+type vcardProperty struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+func (p vcardProperty) param(name string) string {
+	if v := p.Params[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// unfoldLines splits r into logical lines, joining folded continuation lines
+// and quoted-printable soft line breaks.
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			lines[len(lines)-1] += line[1:]
+		case len(lines) > 0 && isSoftBreak(lines[len(lines)-1]):
+			last := lines[len(lines)-1]
+			lines[len(lines)-1] = last[:len(last)-1] + line
+		case line != "":
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func isSoftBreak(line string) bool {
+	return strings.HasSuffix(line, "=") &&
+		strings.Contains(strings.ToUpper(line[:strings.Index(line+":", ":")]), "QUOTED-PRINTABLE")
+}
+
+// parseVCardLine splits a content line into its name, parameters and value.
+func parseVCardLine(line string) (vcardProperty, bool) {
+	colon, quoted := -1, false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return vcardProperty{}, false
+	}
+	prop := vcardProperty{Value: line[colon+1:], Params: map[string][]string{}}
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	if dot := strings.LastIndex(prop.Name, "."); dot >= 0 {
+		prop.Name = prop.Name[dot+1:]
+	}
+	for _, param := range parts[1:] {
+		key, value := param, ""
+		if eq := strings.Index(param, "="); eq >= 0 {
+			key, value = param[:eq], param[eq+1:]
+		} else {
+			// vCard 2.1 allows bare types, e.g. TEL;HOME;VOICE
+			key, value = "TYPE", param
+		}
+		key = strings.ToUpper(key)
+		for _, v := range strings.Split(value, ",") {
+			prop.Params[key] = append(prop.Params[key], strings.Trim(v, `"`))
+		}
+	}
+	if strings.EqualFold(prop.param("ENCODING"), "QUOTED-PRINTABLE") {
+		if decoded, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(prop.Value))); err == nil {
+			prop.Value = string(decoded)
+		}
+	}
+	return prop, true
+}
+
+func (c *Contact) setVCardProperty(prop vcardProperty) {
+	switch prop.Name {
+	case "FN":
+		c.Name = unescapeVCard(prop.Value)
+	case "N":
+		parts := splitVCard(prop.Value, ';')
+		for len(parts) < 5 {
+			parts = append(parts, "")
+		}
+		c.SetName(Name{
+			Last:   joinVCardList(parts[0]),
+			First:  joinVCardList(parts[1]),
+			Middle: joinVCardList(parts[2]),
+			Prefix: joinVCardList(parts[3]),
+			Suffix: joinVCardList(parts[4]),
+		})
+	case "NICKNAME":
+		c.Nickname = append(c.Nickname, splitVCardList(prop.Value)...)
+	case "X-PHONETIC-FIRST-NAME":
+		c.PhoneticFirst = unescapeVCard(prop.Value)
+	case "X-PHONETIC-LAST-NAME":
+		c.PhoneticLast = unescapeVCard(prop.Value)
+	case "EMAIL":
+		c.Email = append(c.Email, strings.TrimPrefix(unescapeVCard(prop.Value), "mailto:"))
+	case "TEL":
+		c.Phone = append(c.Phone, strings.TrimPrefix(unescapeVCard(prop.Value), "tel:"))
+	case "ADR":
+		if c.HasAddress() {
+			// Only the first address fits in a Contact.
+			return
+		}
+		parts := splitVCard(prop.Value, ';')
+		for len(parts) < 7 {
+			parts = append(parts, "")
+		}
+		var street []string
+		for _, part := range append(splitVCardList(parts[1]), splitVCardList(parts[2])...) {
+			street = append(street, strings.Split(part, "\n")...)
+		}
+		c.Street = dedupe(street)
+		c.City = joinVCardList(parts[3])
+		c.State = joinVCardList(parts[4])
+		c.Zip = joinVCardList(parts[5])
+		c.Country = countryFromName(joinVCardList(parts[6]))
+	case "BDAY":
+		c.Birthday = parseVCardDate(prop.Value)
+		if omit := prop.param("X-APPLE-OMIT-YEAR"); omit != "" && omit == fmt.Sprint(c.Birthday.Year()) {
+			c.Birthday = c.Birthday.AddDate(-c.Birthday.Year(), 0, 0)
+		}
+	case "CATEGORIES":
+		c.Labels = append(c.Labels, splitVCardList(prop.Value)...)
+	}
+}
+
+// finishVCard fills in anything the card left implicit.
+func (c *Contact) finishVCard() *Contact {
+	if c.First == "" && c.Last == "" && c.Name != "" {
+		c.SetName(ParseName(c.Name))
+	}
+	c.Nickname = dedupe(c.Nickname)
+	c.Email = dedupe(c.Email)
+	c.Phone = dedupe(c.Phone)
+	c.Labels = dedupe(c.Labels)
+	return c
+}
+
+var vcardDateFormats = []string{
+	"20060102",
+	"2006-01-02",
+	"--0102",
+	"--01-02",
+}
+
+func parseVCardDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if t := strings.IndexAny(value, "T"); t > 0 {
+		value = value[:t]
+	}
+	for _, format := range vcardDateFormats {
+		if date, err := time.Parse(format, value); err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// countryFromName returns the country code for a country name, or the name
+// itself when it is not known.
+func countryFromName(name string) string {
+	for code, known := range countryNames {
+		if strings.EqualFold(known, name) {
+			return code
+		}
+	}
+	return name
+}
+
+var vcardUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\n`, "\n",
+	`\N`, "\n",
+	`\,`, ",",
+	`\;`, ";",
+	`\:`, ":",
+)
+
+func unescapeVCard(value string) string { return vcardUnescaper.Replace(value) }
+
+// splitVCard splits value on sep, ignoring separators escaped with a
+// backslash. The parts are returned still escaped.
+func splitVCard(value string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+func splitVCardList(value string) []string {
+	var values []string
+	for _, part := range splitVCard(value, ',') {
+		if part = strings.TrimSpace(unescapeVCard(part)); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func joinVCardList(value string) string { return strings.Join(splitVCardList(value), " ") }
@@ -0,0 +1,154 @@
+package contacts
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVCardExport(t *testing.T) {
+	c := &Contact{
+		ID:       "cn=Jane Doe,ou=contacts,dc=example,dc=org",
+		Prefix:   "Dr.",
+		First:    "Jane",
+		Middle:   "Q.",
+		Last:     "Doe",
+		Email:    []string{"jane@example.org"},
+		Phone:    []string{"+15551234567"},
+		Street:   []string{"1 Main St", "Apt 2"},
+		City:     "Springfield",
+		State:    "IL",
+		Zip:      "62701",
+		Country:  "US",
+		Birthday: time.Date(0, time.February, 3, 0, 0, 0, 0, time.UTC),
+		Labels:   []string{"family", "a,b"},
+	}
+	v4 := c.VCard(VCard4, "")
+	unfolded := strings.Replace(v4, "\r\n ", "", -1)
+	for _, expected := range []string{
+		"BEGIN:VCARD\r\nVERSION:4.0\r\n",
+		"FN:Jane Q. Doe\r\n",
+		"N:Doe;Jane;Q.;Dr.;\r\n",
+		"EMAIL:jane@example.org\r\n",
+		"TEL;VALUE=uri:tel:+15551234567\r\n",
+		":;;1 Main St,Apt 2;Springfield;IL;62701;United States\r\n",
+		"BDAY:--0203\r\n",
+		"CATEGORIES:family,a\\,b\r\n",
+		"UID:urn:uuid:",
+		"END:VCARD\r\n",
+	} {
+		if !strings.Contains(unfolded, expected) {
+			t.Errorf("expected %q in:\n%s", expected, v4)
+		}
+	}
+	v3 := c.VCard(VCard3, "")
+	for _, expected := range []string{
+		"VERSION:3.0\r\n",
+		"EMAIL;TYPE=INTERNET:jane@example.org\r\n",
+		"LABEL:1 Main St\\nApt 2\\nSpringfield\\, IL 62701\\nUNITED STATES\r\n",
+	} {
+		if !strings.Contains(v3, expected) {
+			t.Errorf("expected %q in:\n%s", expected, v3)
+		}
+	}
+	for _, line := range strings.Split(v4, "\r\n") {
+		if len(line) > vcardLineLength {
+			t.Errorf("line not folded: %q", line)
+		}
+	}
+}
+
+func TestVCardExportRegion(t *testing.T) {
+	c := &Contact{ID: "cn=Hans,ou=contacts,dc=example", Name: "Hans", Phone: []string{"030 123456"}}
+	if v4 := c.VCard(VCard4, "DE"); !strings.Contains(v4, "TEL;VALUE=uri:tel:+4930123456\r\n") {
+		t.Errorf("phone not read in the default region:\n%s", v4)
+	}
+	c.Country = "DE"
+	if v4 := c.VCard(VCard4, "US"); !strings.Contains(v4, "TEL;VALUE=uri:tel:+4930123456\r\n") {
+		t.Errorf("phone not read in the contact's country:\n%s", v4)
+	}
+}
+
+func TestParseVCards(t *testing.T) {
+	data := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"N:van der Berg;Jane;Q.;Dr.;\r\n" +
+		"FN:Jane van der Berg\r\n" +
+		"EMAIL;TYPE=INTERNET,HOME:jane@example.org\r\n" +
+		"item1.TEL;TYPE=CELL:(555) 123-\r\n" +
+		" 4567\r\n" +
+		"ADR;TYPE=HOME:;;1 Main St\\nApt 2;Springfield;IL;62701;United States\r\n" +
+		"BDAY:--0203\r\n" +
+		"CATEGORIES:family,friends\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\n" +
+		"VERSION:2.1\n" +
+		"FN;ENCODING=QUOTED-PRINTABLE;CHARSET=UTF-8:J=C3=BCrgen M=\n" +
+		"=C3=BCller\n" +
+		"TEL;HOME;VOICE:+49 30 123456\n" +
+		"BDAY:1970-05-06\n" +
+		"END:VCARD\n"
+	contacts, err := ParseVCards(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("expected 2 contacts, got %d", len(contacts))
+	}
+	jane, jurgen := contacts[0], contacts[1]
+	if jane.Last != "van der Berg" || jane.First != "Jane" || jane.Prefix != "Dr." {
+		t.Errorf("unexpected name: %+v", jane.StructuredName())
+	}
+	if len(jane.Phone) != 1 || jane.Phone[0] != "(555) 123-4567" {
+		t.Errorf("unexpected phone: %q", jane.Phone)
+	}
+	if len(jane.Street) != 2 || jane.Country != "US" || jane.Zip != "62701" {
+		t.Errorf("unexpected address: %q", jane.AddressLines())
+	}
+	if jane.Birthday.Year() != 0 || jane.Birthday.Month() != time.February || jane.Birthday.Day() != 3 {
+		t.Errorf("unexpected birthday: %v", jane.Birthday)
+	}
+	if len(jane.Labels) != 2 {
+		t.Errorf("unexpected labels: %q", jane.Labels)
+	}
+	if jurgen.Name != "Jürgen Müller" || jurgen.First != "Jürgen" || jurgen.Last != "Müller" {
+		t.Errorf("unexpected quoted-printable name: %+v", jurgen)
+	}
+	if jurgen.Birthday.Year() != 1970 {
+		t.Errorf("unexpected birthday: %v", jurgen.Birthday)
+	}
+
+	roundTrip, err := ParseVCards(strings.NewReader(jane.VCard(VCard4, "")))
+	if err != nil || len(roundTrip) != 1 {
+		t.Fatalf("round trip failed: %v", err)
+	}
+	if roundTrip[0].FullName() != jane.FullName() || roundTrip[0].City != jane.City {
+		t.Errorf("round trip mismatch: %+v", roundTrip[0])
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	existing := []*Contact{
+		{ID: "cn=Jane,ou=contacts", First: "Jane", Last: "Doe", Email: []string{"Jane@Example.org"}},
+		{ID: "cn=John,ou=contacts", First: "John", Last: "Roe", Phone: []string{"+15551234567"}},
+	}
+	incoming := []*Contact{
+		{First: "Jane", Last: "Doe", Email: []string{"jane@example.org"}, Labels: []string{"family"}},
+		{First: "Johnny", Last: "Roe", Phone: []string{"555-123-4567"}},
+		{First: "New", Last: "Person"},
+		{Email: []string{"nobody@example.org"}},
+	}
+	items := planImport(existing, incoming, "US")
+	if items[0].Existing != existing[0] || items[0].MatchedBy != "Email" || len(items[0].Changes["add"]) != 1 {
+		t.Errorf("expected email match adding a label: %+v", items[0])
+	}
+	if items[1].Existing != existing[1] || items[1].MatchedBy != "Phone" {
+		t.Errorf("expected phone match: %+v", items[1])
+	}
+	if !items[2].Create() || items[2].Err != nil {
+		t.Errorf("expected create: %+v", items[2])
+	}
+	if items[3].Err == nil {
+		t.Errorf("expected nameless contact to be invalid: %+v", items[3])
+	}
+}
@@ -0,0 +1,258 @@
+package contacts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WebhookCreate = "create"
+	WebhookUpdate = "update"
+	WebhookDelete = "delete"
+
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// the request body keyed with the webhook's secret.
+	WebhookSignatureHeader = "X-Contacts-Signature"
+
+	maxWebhookAttempts  = 5
+	maxWebhookLogLength = 200
+)
+
+// Webhook is a subscription to contact changes.
+type Webhook struct {
+	URL string
+	// Secret signs deliveries when set.
+	Secret string
+	// Events lists the events delivered: create, update or delete. All
+	// events are delivered when it is empty.
+	Events []string
+}
+
+func (h Webhook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if strings.EqualFold(e, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPayload is the JSON body posted to webhooks.
+type WebhookPayload struct {
+	Delivery string     `json:"delivery"`
+	Event    string     `json:"event"`
+	Time     time.Time  `json:"time"`
+	Contact  APIContact `json:"contact"`
+	// Changes is the changes() diff of the directory attributes by
+	// operation; deletes list the attributes the contact had.
+	Changes map[string]map[string][]string `json:"changes,omitempty"`
+}
+
+// WebhookDelivery records the progress of one payload to one webhook.
+type WebhookDelivery struct {
+	ID       string
+	URL      string
+	Event    string
+	Contact  string
+	Time     time.Time
+	Attempts int
+	Status   int
+	Error    string
+	Done     bool
+}
+
+// Succeeded reports whether the webhook accepted the delivery.
+func (d WebhookDelivery) Succeeded() bool { return d.Done && d.Error == "" }
+
+var (
+	// webhookBackoff is the delay before the first retry; it doubles for
+	// each retry after that.
+	webhookBackoff = 2 * time.Second
+	webhookClient  = &http.Client{Timeout: 10 * time.Second}
+
+	deliveries webhookLog
+	delivering sync.WaitGroup
+)
+
+// WebhookDeliveries returns the most recent deliveries, newest first.
+func WebhookDeliveries() []WebhookDelivery { return deliveries.list() }
+
+// WebhookDeliveryTimeout is the longest a delivery can take, including
+// every retry and the waits between them.
+func WebhookDeliveryTimeout() time.Duration {
+	total, backoff := time.Duration(0), webhookBackoff
+	for attempt := 1; attempt <= maxWebhookAttempts; attempt++ {
+		total += webhookClient.Timeout
+		if attempt < maxWebhookAttempts {
+			total += backoff
+			backoff *= 2
+		}
+	}
+	return total
+}
+
+// WaitForWebhooks waits for the deliveries in progress, including their
+// retries, to finish, or for ctx to be done.
+func WaitForWebhooks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		delivering.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type webhookLog struct {
+	mu      sync.Mutex
+	entries []*WebhookDelivery
+}
+
+func (l *webhookLog) add(d *WebhookDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, d)
+	if len(l.entries) > maxWebhookLogLength {
+		l.entries = l.entries[len(l.entries)-maxWebhookLogLength:]
+	}
+}
+
+func (l *webhookLog) update(d *WebhookDelivery, fn func(*WebhookDelivery)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(d)
+}
+
+func (l *webhookLog) list() []WebhookDelivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]WebhookDelivery, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		list = append(list, *l.entries[i])
+	}
+	return list
+}
+
+// notifyWebhooks delivers event for contact to every subscribed webhook in
+// the background.
+func notifyWebhooks(config Config, event string, contact *Contact, changes map[string]map[string][]string) {
+	for _, hook := range config.Webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+		payload := WebhookPayload{
+			Delivery: newDeliveryID(),
+			Event:    event,
+			Time:     time.Now().UTC(),
+			Contact:  NewAPIContact(contact),
+			Changes:  changes,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("webhook %s: %v", hook.URL, err)
+			continue
+		}
+		d := &WebhookDelivery{
+			ID:      payload.Delivery,
+			URL:     hook.URL,
+			Event:   event,
+			Contact: contact.DisplayName(),
+			Time:    payload.Time,
+		}
+		deliveries.add(d)
+		delivering.Add(1)
+		go func(hook Webhook, d *WebhookDelivery, body []byte) {
+			defer delivering.Done()
+			deliverWebhook(hook, d, body)
+		}(hook, d, body)
+	}
+}
+
+// deliverWebhook posts body to the webhook until it answers with a 2xx
+// status, backing off exponentially between attempts.
+func deliverWebhook(hook Webhook, d *WebhookDelivery, body []byte) {
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		status, err := postWebhook(hook, d, body)
+		done := err == nil || attempt == maxWebhookAttempts
+		deliveries.update(d, func(d *WebhookDelivery) {
+			d.Attempts, d.Status, d.Done, d.Error = attempt, status, done, ""
+			if err != nil {
+				d.Error = err.Error()
+			}
+		})
+		if done {
+			if err != nil {
+				log.Printf("webhook %s: giving up on %s after %d attempts: %v", hook.URL, d.ID, attempt, err)
+			}
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postWebhook(hook Webhook, d *WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "contacts-webhook")
+	req.Header.Set("X-Contacts-Event", d.Event)
+	req.Header.Set("X-Contacts-Delivery", d.ID)
+	if hook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, body))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the signature header value of body for secret.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature is the valid signature of body
+// for secret; receivers can use it to authenticate deliveries.
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
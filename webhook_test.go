@@ -0,0 +1,72 @@
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	received := make(chan WebhookPayload, 1)
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if !VerifyWebhook("secret", body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("bad signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	defer srv.Close()
+
+	config := Config{Webhooks: []Webhook{
+		{URL: srv.URL, Secret: "secret"},
+		{URL: srv.URL, Events: []string{WebhookDelete}},
+	}}
+	original := &Contact{ID: "cn=Jane Doe,ou=contacts,dc=example", Name: "Jane Doe"}
+	updated := &Contact{ID: original.ID, Name: "Jane Doe", Email: []string{"jane@example.com"}}
+	notifyWebhooks(config, WebhookUpdate, updated, original.changes(updated))
+
+	select {
+	case payload := <-received:
+		if payload.Event != WebhookUpdate || payload.Contact.ID != updated.UUID() {
+			t.Errorf("payload = %+v", payload)
+		}
+		if got := payload.Changes["add"]["mail"]; len(got) != 1 || got[0] != "jane@example.com" {
+			t.Errorf("changes = %v", payload.Changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := WebhookDeliveries()[0]; !d.Succeeded() || d.Attempts != 2 || d.Status != http.StatusOK {
+		t.Errorf("delivery = %+v", d)
+	}
+}
+
+func TestWebhookDeliveryTimeout(t *testing.T) {
+	// Five attempts of up to 10s each, with 2s, 4s, 8s and 16s between them.
+	if got := WebhookDeliveryTimeout(); got != 80*time.Second {
+		t.Errorf("WebhookDeliveryTimeout() = %v", got)
+	}
+}